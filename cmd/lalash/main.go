@@ -10,6 +10,9 @@ import (
 func main() {
 	c := flag.Bool("c", false, "")
 	s := flag.Bool("s", false, "")
+	l := flag.Bool("l", false, "")
+	norc := flag.Bool("norc", false, "")
+	rcfile := flag.String("rcfile", "", "")
 	flag.Parse()
 
 	if *c && *s {
@@ -22,6 +25,10 @@ func main() {
 	case *s:
 		os.Exit(lalash.RunScriptFile(flag.Arg(0)))
 	default:
-		os.Exit(lalash.RunREPL())
+		os.Exit(lalash.RunREPL(lalash.Options{
+			NoRC:   *norc,
+			RCFile: *rcfile,
+			Login:  *l,
+		}))
 	}
 }
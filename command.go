@@ -1,8 +1,13 @@
 package lalash
 
 import (
+	"context"
 	"io"
 	"os"
+	"path/filepath"
+
+	"github.com/w-haibara/lalash/editor"
+	"github.com/w-haibara/lalash/history"
 )
 
 type Command struct {
@@ -11,6 +16,16 @@ type Command struct {
 	Stderr     io.Writer
 	ExtraFiles []*os.File
 	Internal   Internal
+
+	job   *Job            // the background job being evaluated, if any
+	tty   *os.File        // the terminal of an interactive shell, if any
+	scope context.Context // the scope of a function, which tasks end with; nil for the shell
+
+	signals *signals // the signal handling of the shell, if any
+	wd      *workDir // the working directory of the shell
+	last    *lastLine
+	hist    *history.History // the history of an interactive shell, if any
+	line    *editor.Editor   // the line editor of an interactive shell, if any
 }
 
 func cmdNew() Command {
@@ -19,11 +34,38 @@ func cmdNew() Command {
 		Stdout:   os.Stdout,
 		Stderr:   os.Stderr,
 		Internal: NewInternal(),
+		wd:       newWorkDir(),
+		last:     &lastLine{},
 	}
+	cmd.setInternalHelpFamily()
 	cmd.setInternalUtilFamily()
 	cmd.setInternalAliasFamily()
+	cmd.setInternalTypeFamily()
 	cmd.setInternalVarFamily()
 	cmd.setInternalEvalFamily()
 	cmd.setInternalStringFamily()
+	cmd.setInternalRegexpFamily()
+	cmd.setInternalJSONFamily()
+	cmd.setInternalCSVFamily()
+	cmd.setInternalFileFamily()
+	cmd.setInternalPathFamily()
+	cmd.setInternalJobFamily()
+	cmd.setInternalTaskFamily()
+	cmd.setInternalTrapFamily()
+	cmd.setInternalDirFamily()
+	cmd.setInternalImportFamily()
+	cmd.setInternalPromptFamily()
+	cmd.setInternalCompleteFamily()
+	cmd.setInternalHistoryFamily()
+	cmd.setInternalBindFamily()
 	return cmd
 }
+
+// absPath resolves name against the working directory of the shell.
+func (cmd Command) absPath(name string) (string, error) {
+	pwd := cmd.wd.get()
+	if pwd == "" || filepath.IsAbs(name) {
+		return filepath.Abs(name)
+	}
+	return filepath.Join(pwd, name), nil
+}
@@ -0,0 +1,269 @@
+package lalash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/w-haibara/lalash/parser"
+)
+
+// completionWords splits the text before the cursor into the words of the
+// command being typed and the word under the cursor, which begins at start.
+func completionWords(before string) (words []string, word string, start int) {
+	r := []rune(before)
+
+	start = len(r)
+	for start > 0 && !strings.ContainsRune(" \t;&({", r[start-1]) {
+		start--
+	}
+	word = string(r[start:])
+
+	// The command begins after the last separator or the last block or
+	// substitution left open.
+	segStart := 0
+	stack := []int{}
+	inString := false
+	for i, c := range r[:start] {
+		switch {
+		case inString:
+			if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ';' || c == '&':
+			segStart = i + 1
+		case c == '(' || c == '{':
+			stack = append(stack, segStart)
+			segStart = i + 1
+		case c == ')' || c == '}':
+			if len(stack) > 0 {
+				segStart = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	seg := string(r[segStart:start])
+	if tokens, err := parser.Parse(seg); err == nil {
+		for _, v := range tokens {
+			if strings.TrimSpace(v.Val) != "" && v.Kind != parser.SeparateToken && v.Kind != parser.BackgroundToken {
+				words = append(words, v.Val)
+			}
+		}
+	} else {
+		words = strings.Fields(seg)
+	}
+
+	return words, word, start
+}
+
+// complete returns the candidates for the word under the cursor at pos, in
+// runes, with the text before and after the word.
+func (cmd Command) complete(line string, pos int) (head string, candidates []string, tail string) {
+	r := []rune(line)
+	if pos > len(r) {
+		pos = len(r)
+	}
+
+	words, word, start := completionWords(string(r[:pos]))
+	head, tail = string(r[:start]), string(r[pos:])
+
+	switch {
+	case len(words) == 0 && !strings.ContainsRune(word, '/'):
+		candidates = cmd.completeCommands(word)
+	case len(words) == 0:
+		candidates = cmd.completeFiles(word)
+	case words[0] == "l-var" && words[len(words)-1] == "--ref":
+		candidates = cmd.completeVars(word)
+	default:
+		if v, ok := cmd.Internal.Completions.Load(words[0]); ok {
+			candidates = cmd.completeUser(v.(string), words, word)
+			break
+		}
+		if strings.HasPrefix(word, "-") {
+			candidates = cmd.completeFlags(words[0], word)
+			break
+		}
+		candidates = cmd.completeFiles(word)
+	}
+
+	return head, candidates, tail
+}
+
+func withPrefix(names []string, prefix, suffix string) []string {
+	res := []string{}
+	seen := map[string]bool{}
+	for _, v := range names {
+		if strings.HasPrefix(v, prefix) && !seen[v] {
+			seen[v] = true
+			res = append(res, v+suffix)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// completeCommands completes builtins, aliases, functions and the executables
+// in PATH.
+func (cmd Command) completeCommands(word string) []string {
+	names := append(cmd.Internal.GetCmdsAll(), cmd.Internal.GetAliasAll()...)
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !strings.HasPrefix(e.Name(), word) || e.IsDir() {
+				continue
+			}
+			if info, err := e.Info(); err == nil && info.Mode()&0111 != 0 {
+				names = append(names, e.Name())
+			}
+		}
+	}
+
+	return withPrefix(names, word, " ")
+}
+
+// completeVars completes the names of the variables, which are read with
+// "l-var --ref".
+func (cmd Command) completeVars(word string) []string {
+	names := []string{}
+	cmd.Internal.rangeVars(func(name, value string) {
+		names = append(names, name)
+	})
+	return withPrefix(names, word, " ")
+}
+
+func (cmd Command) completeFlags(name, word string) []string {
+	c, err := cmd.Internal.Get(name)
+	if err != nil {
+		return nil
+	}
+	return withPrefix(c.flagNames(), word, " ")
+}
+
+// completeFiles completes the paths which begin with word. Directories end
+// with "/" so that completion can go on into them.
+func (cmd Command) completeFiles(word string) []string {
+	dir, base := "", word
+	if i := strings.LastIndex(word, "/"); i >= 0 {
+		dir, base = word[:i+1], word[i+1:]
+	}
+
+	d, err := expandTilde(dir)
+	if err != nil {
+		return nil
+	}
+	if d == "" {
+		d = "."
+	}
+	d, err = cmd.absPath(d)
+	if err != nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir(d)
+	if err != nil {
+		return nil
+	}
+
+	res := []string{}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+
+		isDir := e.IsDir()
+		if e.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(d, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+
+		if isDir {
+			res = append(res, dir+name+"/")
+		} else {
+			res = append(res, dir+name+" ")
+		}
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// completeUser calls a completion function registered with l-complete. It
+// receives the word under the cursor followed by the words of the command, and
+// prints a candidate on each line.
+func (cmd Command) completeUser(fn string, words []string, word string) []string {
+	c := cmd
+	c.Stdin = strings.NewReader("")
+	c.Stderr = new(strings.Builder)
+
+	out, err := callFuncOutput(context.Background(), c, fn, append([]string{word}, words...)...)
+	if err != nil {
+		return nil
+	}
+
+	return withPrefix(strings.Split(out, "\n"), word, " ")
+}
+
+func (cmd Command) setInternalCompleteFamily() {
+	cmd.Internal.Cmds.Store("l-complete", InternalCmd{
+		Synopsis: "l-complete <command> {block} | --del <command> | --list",
+		Desc: "Registers a function which completes the arguments of command.\n" +
+			"The block receives the word under the cursor followed by the words of the command line, and prints a candidate on each line.",
+		Flags: []Flag{
+			{Name: "del", Value: false, Usage: "remove the completion of command"},
+			{Name: "list", Value: false, Usage: "list the completions"},
+		},
+		Examples: []string{"l-complete git {l-echo add; l-echo commit; l-echo push}"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-complete", argv)
+			if err != nil {
+				return err
+			}
+			del := flagBool(f, "del")
+			list := flagBool(f, "list")
+
+			switch {
+			case list:
+				names := []string{}
+				cmd.Internal.Completions.Range(func(key, value interface{}) bool {
+					names = append(names, key.(string))
+					return true
+				})
+				sort.Strings(names)
+
+				for _, name := range names {
+					v, _ := cmd.Internal.Completions.Load(name)
+					fmt.Fprintln(cmd.Stdout, name, ":", v)
+				}
+
+			case del:
+				if err := checkArgv(f.Args(), 1); err != nil {
+					return err
+				}
+				cmd.Internal.Completions.Delete(f.Arg(0))
+
+			default:
+				if err := checkArgv(f.Args(), 2); err != nil {
+					return err
+				}
+				cmd.Internal.Completions.Store(f.Arg(0), f.Arg(1))
+			}
+
+			return nil
+		},
+	})
+}
@@ -0,0 +1,499 @@
+package editor
+
+import (
+	"io"
+	"strings"
+	"unicode"
+)
+
+// actions are the things which keys do. Each one is called with the key
+// which is pressed.
+var actions map[string]func(s *state, key string) error
+
+func init() {
+	actions = map[string]func(s *state, key string) error{
+		"self-insert": func(s *state, key string) error {
+			s.insert([]rune(key))
+			return nil
+		},
+
+		"accept-line": func(s *state, key string) error {
+			s.moveToEnd()
+			s.done = true
+			return nil
+		},
+
+		"interrupt": func(s *state, key string) error {
+			s.pos = len(s.buf)
+			s.drawLine(s.prompt, s.buf, s.pos, nil)
+			s.write("^C\r\n")
+			s.row = 0
+			s.setLine(nil)
+			s.hist = len(s.e.history)
+			if km := modes[s.e.mode]; s.e.keymap != km {
+				s.setKeymap(km)
+			}
+			return nil
+		},
+
+		"delete-char-or-eof": func(s *state, key string) error {
+			if len(s.buf) == 0 {
+				s.write("\r\n")
+				return io.EOF
+			}
+			s.delete(s.pos, s.pos+1)
+			return nil
+		},
+
+		"beginning-of-line": func(s *state, key string) error {
+			s.pos = 0
+			return nil
+		},
+
+		"end-of-line": func(s *state, key string) error {
+			if !s.acceptHint(len(s.hint)) {
+				s.pos = len(s.buf)
+			}
+			return nil
+		},
+
+		"backward-char": func(s *state, key string) error {
+			if s.pos > 0 {
+				s.pos--
+			}
+			return nil
+		},
+
+		"forward-char": func(s *state, key string) error {
+			if s.acceptHint(len(s.hint)) {
+				return nil
+			}
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+			return nil
+		},
+
+		"backward-word": func(s *state, key string) error {
+			s.pos = s.wordStart(isWordChar)
+			return nil
+		},
+
+		"forward-word": func(s *state, key string) error {
+			if s.acceptHint(s.hintWord()) {
+				return nil
+			}
+			s.pos = s.wordEnd(isWordChar)
+			return nil
+		},
+
+		"accept-suggestion": func(s *state, key string) error {
+			s.acceptHint(len(s.hint))
+			return nil
+		},
+
+		"accept-suggestion-word": func(s *state, key string) error {
+			s.acceptHint(s.hintWord())
+			return nil
+		},
+
+		"backward-delete-char": func(s *state, key string) error {
+			s.delete(s.pos-1, s.pos)
+			return nil
+		},
+
+		"delete-char": func(s *state, key string) error {
+			s.delete(s.pos, s.pos+1)
+			return nil
+		},
+
+		"kill-line": func(s *state, key string) error {
+			s.killRange(s.pos, len(s.buf))
+			return nil
+		},
+
+		"unix-line-discard": func(s *state, key string) error {
+			s.killRange(0, s.pos)
+			return nil
+		},
+
+		"unix-word-rubout": func(s *state, key string) error {
+			s.killRange(s.wordStart(isNotSpace), s.pos)
+			return nil
+		},
+
+		"backward-kill-word": func(s *state, key string) error {
+			s.killRange(s.wordStart(isWordChar), s.pos)
+			return nil
+		},
+
+		"kill-word": func(s *state, key string) error {
+			s.killRange(s.pos, s.wordEnd(isWordChar))
+			return nil
+		},
+
+		"yank": func(s *state, key string) error {
+			s.insert(s.e.kill)
+			return nil
+		},
+
+		"previous-history": func(s *state, key string) error {
+			if s.hist == 0 {
+				return nil
+			}
+			if s.hist == len(s.e.history) {
+				s.saved = append([]rune{}, s.buf...)
+			}
+			s.hist--
+			s.setLine([]rune(s.e.history[s.hist]))
+			return nil
+		},
+
+		"next-history": func(s *state, key string) error {
+			if s.hist >= len(s.e.history) {
+				return nil
+			}
+			s.hist++
+			if s.hist == len(s.e.history) {
+				s.setLine(s.saved)
+				return nil
+			}
+			s.setLine([]rune(s.e.history[s.hist]))
+			return nil
+		},
+
+		"reverse-search-history": func(s *state, key string) error {
+			return s.search()
+		},
+
+		"complete": func(s *state, key string) error {
+			s.complete()
+			return nil
+		},
+
+		"clear-screen": func(s *state, key string) error {
+			s.write("\x1b[H\x1b[2J")
+			s.row = 0
+			return nil
+		},
+
+		"kill-whole-line": func(s *state, key string) error {
+			s.killRange(0, len(s.buf))
+			return nil
+		},
+
+		"vi-command-mode": func(s *state, key string) error {
+			// The cursor is on a character in the command mode.
+			if s.pos > 0 {
+				s.pos--
+			}
+			s.setKeymap("vi-command")
+			return nil
+		},
+
+		"vi-insert-mode": func(s *state, key string) error {
+			s.setKeymap("vi-insert")
+			return nil
+		},
+
+		"vi-append": func(s *state, key string) error {
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+			s.setKeymap("vi-insert")
+			return nil
+		},
+
+		"vi-insert-beginning": func(s *state, key string) error {
+			s.pos = 0
+			s.setKeymap("vi-insert")
+			return nil
+		},
+
+		"vi-append-end": func(s *state, key string) error {
+			s.pos = len(s.buf)
+			s.setKeymap("vi-insert")
+			return nil
+		},
+
+		"vi-forward-word": func(s *state, key string) error {
+			s.pos = s.viWordNext()
+			return nil
+		},
+
+		"vi-end-word": func(s *state, key string) error {
+			i := s.pos + 1
+			for i < len(s.buf) && unicode.IsSpace(s.buf[i]) {
+				i++
+			}
+			if i >= len(s.buf) {
+				return nil
+			}
+			class := charClass(s.buf[i])
+			for i+1 < len(s.buf) && charClass(s.buf[i+1]) == class {
+				i++
+			}
+			s.pos = i
+			return nil
+		},
+
+		"vi-delete-word": func(s *state, key string) error {
+			s.killRange(s.pos, s.viWordNext())
+			return nil
+		},
+
+		"vi-change-word": func(s *state, key string) error {
+			i := s.pos
+			if i < len(s.buf) {
+				class := charClass(s.buf[i])
+				for i < len(s.buf) && charClass(s.buf[i]) == class {
+					i++
+				}
+			}
+			s.killRange(s.pos, i)
+			s.setKeymap("vi-insert")
+			return nil
+		},
+
+		"vi-change-to-end": func(s *state, key string) error {
+			s.killRange(s.pos, len(s.buf))
+			s.setKeymap("vi-insert")
+			return nil
+		},
+
+		"vi-change-line": func(s *state, key string) error {
+			s.killRange(0, len(s.buf))
+			s.setKeymap("vi-insert")
+			return nil
+		},
+
+		"vi-put": func(s *state, key string) error {
+			if len(s.e.kill) == 0 {
+				return nil
+			}
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+			s.insert(s.e.kill)
+			s.pos--
+			return nil
+		},
+	}
+}
+
+func isChar(key string) bool {
+	r := []rune(key)
+	return len(r) == 1 && unicode.IsPrint(r[0])
+}
+
+// charClass tells the words of the vi mode, which are runs of letters and
+// digits, or of other characters which are not spaces.
+func charClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case isWordChar(r) || r == '_':
+		return 1
+	}
+	return 2
+}
+
+// viWordNext returns the start of the word after the cursor.
+func (s *state) viWordNext() int {
+	i := s.pos
+	if i < len(s.buf) {
+		class := charClass(s.buf[i])
+		for i < len(s.buf) && class != 0 && charClass(s.buf[i]) == class {
+			i++
+		}
+	}
+	for i < len(s.buf) && unicode.IsSpace(s.buf[i]) {
+		i++
+	}
+	return i
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isNotSpace(r rune) bool {
+	return !unicode.IsSpace(r)
+}
+
+// wordStart returns the start of the word before the cursor, where a word
+// is a run of the characters for which in is true.
+func (s *state) wordStart(in func(rune) bool) int {
+	i := s.pos
+	for i > 0 && !in(s.buf[i-1]) {
+		i--
+	}
+	for i > 0 && in(s.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the end of the word after the cursor.
+func (s *state) wordEnd(in func(rune) bool) int {
+	i := s.pos
+	for i < len(s.buf) && !in(s.buf[i]) {
+		i++
+	}
+	for i < len(s.buf) && in(s.buf[i]) {
+		i++
+	}
+	return i
+}
+
+// acceptHint appends the first n characters of the suggestion to the line.
+// It reports whether there is a suggestion to accept.
+func (s *state) acceptHint(n int) bool {
+	if len(s.hint) == 0 || s.pos != len(s.buf) {
+		return false
+	}
+	s.insert(s.hint[:n])
+	return true
+}
+
+// hintWord returns the length of the first word of the suggestion, with the
+// characters before it.
+func (s *state) hintWord() int {
+	i := 0
+	for i < len(s.hint) && !isWordChar(s.hint[i]) {
+		i++
+	}
+	for i < len(s.hint) && isWordChar(s.hint[i]) {
+		i++
+	}
+	return i
+}
+
+func (s *state) insert(text []rune) {
+	buf := append([]rune{}, s.buf[:s.pos]...)
+	buf = append(buf, text...)
+	s.buf = append(buf, s.buf[s.pos:]...)
+	s.pos += len(text)
+}
+
+func (s *state) delete(from, to int) {
+	if from < 0 || to > len(s.buf) || from >= to {
+		return
+	}
+	s.buf = append(s.buf[:from], s.buf[to:]...)
+	if s.pos > to {
+		s.pos -= to - from
+	} else if s.pos > from {
+		s.pos = from
+	}
+}
+
+// killRange deletes the text from from to to and keeps it to be yanked.
+func (s *state) killRange(from, to int) {
+	if from >= to {
+		return
+	}
+	s.e.kill = append([]rune{}, s.buf[from:to]...)
+	s.delete(from, to)
+}
+
+// complete replaces the word at the cursor with the candidate of
+// completion, or with the prefix which the candidates share. If there is no
+// such prefix, the candidates are listed when the key is pressed again.
+func (s *state) complete() {
+	if s.e.Complete == nil {
+		return
+	}
+
+	head, candidates, tail := s.e.Complete(string(s.buf), s.pos)
+	if len(candidates) == 0 {
+		return
+	}
+
+	prefix := candidates[0]
+	for _, v := range candidates[1:] {
+		for !strings.HasPrefix(v, prefix) {
+			prefix = string([]rune(prefix)[:len([]rune(prefix))-1])
+		}
+	}
+
+	word := string(s.buf[len([]rune(head)):s.pos])
+	if len(prefix) > len(word) {
+		s.buf = []rune(head + prefix + tail)
+		s.pos = len([]rune(head + prefix))
+		return
+	}
+
+	if len(candidates) > 1 && s.last == "complete" {
+		names := []string{}
+		for _, v := range candidates {
+			names = append(names, strings.TrimSuffix(v, " "))
+		}
+		s.showCandidates(names)
+	}
+}
+
+// search finds the lines of the history which contain the text typed, from
+// the newest one. A key which does not edit the text ends the search, with
+// the line found, and then does what it is bound to.
+func (s *state) search() error {
+	query := []rune{}
+	i := len(s.e.history)
+	found := s.buf
+
+	find := func(from int) {
+		if from >= len(s.e.history) {
+			from = len(s.e.history) - 1
+		}
+		for j := from; j >= 0; j-- {
+			if strings.Contains(s.e.history[j], string(query)) {
+				i = j
+				found = []rune(s.e.history[j])
+				return
+			}
+		}
+	}
+
+	for {
+		prompt := "(reverse-i-search)`" + string(query) + "': "
+		pos := len(found)
+		if k := strings.Index(string(found), string(query)); k >= 0 && len(query) > 0 {
+			pos = len([]rune(string(found)[:k]))
+		}
+		s.drawLine(prompt, found, pos, nil)
+
+		key, err := s.e.readKey()
+		if err != nil {
+			return err
+		}
+
+		switch action := s.action(key); {
+		case action == "reverse-search-history":
+			find(i - 1)
+			continue
+
+		case action == "backward-delete-char":
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(s.e.history) - 1)
+			}
+			continue
+
+		case key == "ctrl-g", action == "interrupt":
+			return nil
+
+		case isChar(key):
+			query = append(query, []rune(key)...)
+			find(i)
+			continue
+		}
+
+		s.setLine(found)
+		if i < len(s.e.history) {
+			s.hist = i
+		}
+		s.draw()
+
+		return s.handle(key)
+	}
+}
@@ -0,0 +1,347 @@
+// Package editor is the line editor of the REPL. It redraws the line as it
+// is edited, so that it can be colored.
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Editor reads lines from a terminal.
+type Editor struct {
+	// Highlight returns line with escape sequences for colors. It must
+	// not change the text of the line otherwise.
+	Highlight func(line string) string
+
+	// Complete returns the candidates for the word at pos, in runes, with
+	// the text before and after the word.
+	Complete func(line string, pos int) (head string, candidates []string, tail string)
+
+	// Suggest returns a line which begins with line, to be shown after it
+	// as a suggestion.
+	Suggest func(line string) string
+
+	// Refresh returns the prompt again when the keymap changes, so that
+	// the prompt can show the mode.
+	Refresh func() string
+
+	in      *os.File
+	out     *os.File
+	keymaps map[string]*keymap
+	mode    string
+	keymap  string // the keymap in use
+	history []string
+	kill    []rune
+}
+
+// New returns an editor reading from the terminal in and drawing on out, in
+// the emacs mode.
+func New(in, out *os.File) *Editor {
+	return &Editor{
+		in:      in,
+		out:     out,
+		keymaps: defaultKeymaps(),
+		mode:    "emacs",
+		keymap:  modes["emacs"],
+	}
+}
+
+// AppendHistory adds line to the lines which can be recalled.
+func (e *Editor) AppendHistory(line string) {
+	e.history = append(e.history, line)
+}
+
+// Supported reports whether the lines can be edited. If not, Prompt reads
+// them as they are.
+func (e *Editor) Supported() bool {
+	switch os.Getenv("TERM") {
+	case "", "dumb", "cons25", "emacs":
+		return false
+	}
+	return isTerminal(e.in.Fd()) && isTerminal(e.out.Fd())
+}
+
+// Prompt shows prompt and returns the line which is typed. It returns
+// io.EOF if the input ends before a line is typed.
+func (e *Editor) Prompt(prompt string) (string, error) {
+	if !e.Supported() {
+		return e.readPlain(prompt)
+	}
+
+	restore, err := makeRaw(e.in.Fd())
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+
+	s := &state{
+		e:       e,
+		prompt:  prompt,
+		hist:    len(e.history),
+		restore: restore,
+	}
+	defer func() {
+		s.restore()
+		e.keymap = modes[e.mode]
+	}()
+	s.draw()
+
+	for !s.done {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		if err := s.handle(key); err != nil {
+			return "", err
+		}
+	}
+
+	return string(s.buf), nil
+}
+
+// readPlain reads a line without editing it. The input is read a byte at a
+// time, so that what follows the line is left to the commands.
+func (e *Editor) readPlain(prompt string) (string, error) {
+	fmt.Fprint(e.out, stripEscapes(prompt))
+
+	line := []byte{}
+	b := make([]byte, 1)
+	for {
+		n, err := e.in.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				return strings.TrimSuffix(string(line), "\r"), nil
+			}
+			line = append(line, b[0])
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			return string(line), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// stripEscapes removes the control sequences, such as colors, from s.
+func stripEscapes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != 27 || i+1 >= len(s) || s[i+1] != '[' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i += 2
+		for i < len(s) && (s[i] < 0x40 || s[i] > 0x7e) {
+			i++
+		}
+	}
+	return b.String()
+}
+
+// width returns the number of columns which s takes on the terminal.
+func width(s string) int {
+	return runewidth.StringWidth(stripEscapes(s))
+}
+
+// state is the line being edited.
+type state struct {
+	e      *Editor
+	prompt string
+	buf    []rune
+	pos    int
+	row    int    // the row of the cursor below the first one of the prompt
+	hint   []rune // the rest of the suggestion shown after the line
+	done   bool
+	last   string // the action done before
+	hist   int    // the history entry shown, or len(history) for the new line
+	saved  []rune // the new line while the history is shown
+
+	pending []string // the keys of a sequence being typed
+	restore func()   // puts the terminal back in its normal mode
+}
+
+// action returns the action which key is bound to alone.
+func (s *state) action(key string) string {
+	return s.e.keymaps[s.e.keymap].bindings[key].Action
+}
+
+// handle does what key, following the keys pending, is bound to.
+func (s *state) handle(key string) error {
+	m := s.e.keymaps[s.e.keymap]
+
+	seq := strings.Join(append(s.pending, key), " ")
+	b, ok := m.bindings[seq]
+	if !ok && m.hasPrefix(seq) {
+		s.pending = append(s.pending, key)
+		return nil
+	}
+
+	// A sequence which is not bound is dropped.
+	pending := s.pending
+	s.pending = nil
+	if !ok {
+		if len(pending) > 0 || !m.insert || !isChar(key) {
+			return nil
+		}
+		b = Binding{Action: "self-insert"}
+	}
+
+	if err := s.run(b, key); err != nil {
+		return err
+	}
+	s.last = b.Action
+
+	if !s.done {
+		s.draw()
+	}
+
+	return nil
+}
+
+func (s *state) run(b Binding, key string) error {
+	if b.Func == nil {
+		f, ok := actions[b.Action]
+		if !ok {
+			return nil
+		}
+		return f(s, key)
+	}
+
+	s.moveToEnd()
+	s.restore()
+
+	line, pos := b.Func(string(s.buf), s.pos)
+
+	restore, err := makeRaw(s.e.in.Fd())
+	if err != nil {
+		return err
+	}
+	s.restore = restore
+
+	s.buf = []rune(line)
+	s.pos = pos
+	if s.pos < 0 || s.pos > len(s.buf) {
+		s.pos = len(s.buf)
+	}
+
+	return nil
+}
+
+// setKeymap changes the keymap in use, and the prompt which shows it.
+func (s *state) setKeymap(name string) {
+	s.e.keymap = name
+	if s.e.Refresh != nil {
+		s.prompt = s.e.Refresh()
+	}
+}
+
+func (s *state) write(text string) {
+	s.e.out.Write([]byte(text))
+}
+
+// draw redraws the line with the suggestion for it, which is shown only
+// while the cursor is at the end of the line.
+func (s *state) draw() {
+	s.hint = nil
+	if s.e.Suggest != nil && s.pos == len(s.buf) && len(s.buf) > 0 {
+		line := string(s.buf)
+		if v := s.e.Suggest(line); strings.HasPrefix(v, line) {
+			s.hint = []rune(strings.TrimPrefix(v, line))
+		}
+	}
+
+	s.drawLine(s.prompt, s.buf, s.pos, s.hint)
+}
+
+// drawLine redraws the prompt and the line followed by hint, which may span
+// several rows of the terminal, and puts the cursor at pos.
+func (s *state) drawLine(prompt string, buf []rune, pos int, hint []rune) {
+	cols := columns(s.e.out.Fd())
+
+	var b bytes.Buffer
+	if s.row > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", s.row)
+	}
+	b.WriteString("\r\x1b[J")
+	b.WriteString(prompt)
+
+	line := string(buf)
+	if s.e.Highlight != nil {
+		line = s.e.Highlight(line)
+	}
+	b.WriteString(line)
+
+	if len(hint) > 0 {
+		b.WriteString("\x1b[2m" + string(hint) + "\x1b[0m")
+	}
+
+	end := width(prompt) + runewidth.StringWidth(string(buf)+string(hint))
+	cur := width(prompt) + runewidth.StringWidth(string(buf[:pos]))
+
+	// The terminal wraps the line only when the next character is written.
+	if end > 0 && end%cols == 0 {
+		b.WriteString("\r\n")
+	}
+
+	if n := end/cols - cur/cols; n > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", n)
+	}
+	b.WriteString("\r")
+	if n := cur % cols; n > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", n)
+	}
+	s.row = cur / cols
+
+	s.e.out.Write(b.Bytes())
+}
+
+// moveToEnd puts the cursor after the line, to write below it. The
+// suggestion is not left on the screen.
+func (s *state) moveToEnd() {
+	s.pos = len(s.buf)
+	s.hint = nil
+	s.drawLine(s.prompt, s.buf, s.pos, nil)
+	s.write("\r\n")
+	s.row = 0
+}
+
+func (s *state) setLine(line []rune) {
+	s.buf = append([]rune{}, line...)
+	s.pos = len(s.buf)
+}
+
+// showCandidates lists the candidates of completion in columns below the
+// line.
+func (s *state) showCandidates(candidates []string) {
+	s.moveToEnd()
+
+	w := 0
+	for _, v := range candidates {
+		if n := runewidth.StringWidth(v); n > w {
+			w = n
+		}
+	}
+	w += 2
+
+	n := columns(s.e.out.Fd()) / w
+	if n < 1 {
+		n = 1
+	}
+
+	var b strings.Builder
+	for i, v := range candidates {
+		b.WriteString(v)
+		if (i+1)%n == 0 || i == len(candidates)-1 {
+			b.WriteString("\r\n")
+			continue
+		}
+		b.WriteString(strings.Repeat(" ", w-runewidth.StringWidth(v)))
+	}
+	s.write(b.String())
+}
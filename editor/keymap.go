@@ -0,0 +1,315 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Binding is what a key sequence does: an action of the editor, or a
+// function.
+type Binding struct {
+	Action string
+
+	// Func is called with the line and the cursor, and returns them
+	// changed. It runs below the line with the terminal in its normal
+	// mode, so that it can write to the terminal and read from it.
+	Func func(line string, pos int) (string, int)
+
+	// Desc describes Func in the list of the bindings.
+	Desc string
+}
+
+func (b Binding) String() string {
+	if b.Func != nil {
+		return b.Desc
+	}
+	return b.Action
+}
+
+// keymap binds key sequences, which are key names separated by spaces such
+// as "ctrl-x ctrl-e".
+type keymap struct {
+	bindings map[string]Binding
+	insert   bool // a character which is not bound is inserted
+}
+
+// hasPrefix reports whether a sequence longer than seq begins with it.
+func (m *keymap) hasPrefix(seq string) bool {
+	for k := range m.bindings {
+		if strings.HasPrefix(k, seq+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// emacsKeymap binds the keys to actions in the way of readline.
+var emacsKeymap = map[string]string{
+	"enter":         "accept-line",
+	"ctrl-j":        "accept-line",
+	"ctrl-c":        "interrupt",
+	"ctrl-d":        "delete-char-or-eof",
+	"ctrl-a":        "beginning-of-line",
+	"home":          "beginning-of-line",
+	"ctrl-e":        "end-of-line",
+	"end":           "end-of-line",
+	"ctrl-b":        "backward-char",
+	"left":          "backward-char",
+	"ctrl-f":        "forward-char",
+	"right":         "forward-char",
+	"alt-b":         "backward-word",
+	"alt-left":      "backward-word",
+	"ctrl-left":     "backward-word",
+	"alt-f":         "forward-word",
+	"alt-right":     "forward-word",
+	"ctrl-right":    "forward-word",
+	"backspace":     "backward-delete-char",
+	"ctrl-h":        "backward-delete-char",
+	"delete":        "delete-char",
+	"ctrl-k":        "kill-line",
+	"ctrl-u":        "unix-line-discard",
+	"ctrl-w":        "unix-word-rubout",
+	"alt-backspace": "backward-kill-word",
+	"alt-d":         "kill-word",
+	"ctrl-y":        "yank",
+	"up":            "previous-history",
+	"ctrl-p":        "previous-history",
+	"down":          "next-history",
+	"ctrl-n":        "next-history",
+	"ctrl-r":        "reverse-search-history",
+	"tab":           "complete",
+	"ctrl-l":        "clear-screen",
+}
+
+// viInsertKeymap is used while text is typed in the vi mode. It has the
+// bindings of emacsKeymap too.
+var viInsertKeymap = map[string]string{
+	"escape": "vi-command-mode",
+}
+
+// viCommandKeymap is used for the commands of the vi mode.
+var viCommandKeymap = map[string]string{
+	"enter":     "accept-line",
+	"ctrl-j":    "accept-line",
+	"ctrl-c":    "interrupt",
+	"ctrl-d":    "delete-char-or-eof",
+	"ctrl-l":    "clear-screen",
+	"h":         "backward-char",
+	"left":      "backward-char",
+	"backspace": "backward-char",
+	"l":         "forward-char",
+	"right":     "forward-char",
+	" ":         "forward-char",
+	"w":         "vi-forward-word",
+	"b":         "backward-word",
+	"e":         "vi-end-word",
+	"0":         "beginning-of-line",
+	"^":         "beginning-of-line",
+	"home":      "beginning-of-line",
+	"$":         "end-of-line",
+	"end":       "end-of-line",
+	"i":         "vi-insert-mode",
+	"insert":    "vi-insert-mode",
+	"a":         "vi-append",
+	"I":         "vi-insert-beginning",
+	"A":         "vi-append-end",
+	"x":         "delete-char",
+	"delete":    "delete-char",
+	"X":         "backward-delete-char",
+	"D":         "kill-line",
+	"d $":       "kill-line",
+	"d 0":       "unix-line-discard",
+	"d d":       "kill-whole-line",
+	"d w":       "vi-delete-word",
+	"C":         "vi-change-to-end",
+	"c $":       "vi-change-to-end",
+	"c c":       "vi-change-line",
+	"S":         "vi-change-line",
+	"c w":       "vi-change-word",
+	"p":         "vi-put",
+	"P":         "yank",
+	"k":         "previous-history",
+	"up":        "previous-history",
+	"ctrl-p":    "previous-history",
+	"j":         "next-history",
+	"down":      "next-history",
+	"ctrl-n":    "next-history",
+	"/":         "reverse-search-history",
+	"ctrl-r":    "reverse-search-history",
+}
+
+// modes are the editing modes, with the keymap each line begins in.
+var modes = map[string]string{
+	"emacs": "emacs",
+	"vi":    "vi-insert",
+}
+
+func defaultKeymaps() map[string]*keymap {
+	keymaps := map[string]*keymap{
+		"emacs":      {bindings: map[string]Binding{}, insert: true},
+		"vi-insert":  {bindings: map[string]Binding{}, insert: true},
+		"vi-command": {bindings: map[string]Binding{}},
+	}
+
+	for k, v := range emacsKeymap {
+		keymaps["emacs"].bindings[k] = Binding{Action: v}
+		keymaps["vi-insert"].bindings[k] = Binding{Action: v}
+	}
+	for k, v := range viInsertKeymap {
+		keymaps["vi-insert"].bindings[k] = Binding{Action: v}
+	}
+	for k, v := range viCommandKeymap {
+		keymaps["vi-command"].bindings[k] = Binding{Action: v}
+	}
+
+	return keymaps
+}
+
+var namedKeys = map[string]bool{
+	"enter":         true,
+	"tab":           true,
+	"shift-tab":     true,
+	"backspace":     true,
+	"escape":        true,
+	"ctrl-space":    true,
+	"alt-backspace": true,
+	"alt-enter":     true,
+}
+
+// modifiedKeys are the keys which may be pressed with shift, alt or ctrl.
+var modifiedKeys = map[string]bool{
+	"up":        true,
+	"down":      true,
+	"right":     true,
+	"left":      true,
+	"home":      true,
+	"end":       true,
+	"insert":    true,
+	"delete":    true,
+	"page-up":   true,
+	"page-down": true,
+}
+
+// validKey reports whether key is the name of a key which can be read.
+func validKey(key string) bool {
+	if utf8.RuneCountInString(key) == 1 || namedKeys[key] {
+		return true
+	}
+
+	if k := strings.TrimPrefix(key, "ctrl-"); len(k) == 1 && k[0] >= 'a' && k[0] <= 'z' {
+		return k != "i" && k != "m"
+	}
+	if k := strings.TrimPrefix(key, "alt-"); len(k) == 1 && k[0] >= ' ' && k[0] < utf8.RuneSelf {
+		return true
+	}
+
+	for _, m := range []string{"", "shift-", "alt-", "ctrl-"} {
+		if strings.HasPrefix(key, m) && modifiedKeys[strings.TrimPrefix(key, m)] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetMode selects the editing mode, "emacs" or "vi".
+func (e *Editor) SetMode(mode string) error {
+	km, ok := modes[mode]
+	if !ok {
+		return fmt.Errorf("invalid editing mode: %v", mode)
+	}
+
+	e.mode = mode
+	e.keymap = km
+
+	return nil
+}
+
+// Mode returns the editing mode.
+func (e *Editor) Mode() string {
+	return e.mode
+}
+
+// Keymap returns the keymap in use, such as "vi-command".
+func (e *Editor) Keymap() string {
+	return e.keymap
+}
+
+// Actions returns the names of the actions which keys can be bound to.
+func Actions() []string {
+	names := []string{}
+	for k := range actions {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *Editor) getKeymap(name string) (*keymap, error) {
+	m, ok := e.keymaps[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid keymap: %v", name)
+	}
+	return m, nil
+}
+
+// Bind binds the key sequence keys in the keymap name.
+func (e *Editor) Bind(name, keys string, b Binding) error {
+	m, err := e.getKeymap(name)
+	if err != nil {
+		return err
+	}
+
+	seq := strings.Fields(keys)
+	if len(seq) == 0 {
+		return fmt.Errorf("no keys")
+	}
+	for _, k := range seq {
+		if !validKey(k) {
+			return fmt.Errorf("invalid key: %v", k)
+		}
+	}
+
+	if b.Func == nil {
+		if _, ok := actions[b.Action]; !ok {
+			return fmt.Errorf("invalid action: %v", b.Action)
+		}
+	}
+
+	m.bindings[strings.Join(seq, " ")] = b
+
+	return nil
+}
+
+// Unbind removes the binding of the key sequence keys in the keymap name.
+func (e *Editor) Unbind(name, keys string) error {
+	m, err := e.getKeymap(name)
+	if err != nil {
+		return err
+	}
+
+	seq := strings.Join(strings.Fields(keys), " ")
+	if _, ok := m.bindings[seq]; !ok {
+		return fmt.Errorf("not bound: %v", keys)
+	}
+	delete(m.bindings, seq)
+
+	return nil
+}
+
+// Bindings returns the bindings of the keymap name.
+func (e *Editor) Bindings(name string) (map[string]Binding, error) {
+	m, err := e.getKeymap(name)
+	if err != nil {
+		return nil, err
+	}
+
+	bindings := map[string]Binding{}
+	for k, v := range m.bindings {
+		bindings[k] = v
+	}
+
+	return bindings, nil
+}
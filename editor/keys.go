@@ -0,0 +1,161 @@
+package editor
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// readByte reads a byte from the terminal. With a timeout set, io.EOF means
+// that nothing came in time.
+func (e *Editor) readByte() (byte, error) {
+	b := make([]byte, 1)
+	if _, err := e.in.Read(b); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// readKey reads a key from the terminal and returns its name, such as "a",
+// "ctrl-a", "alt-f" or "left". A key which is not known is returned as "".
+func (e *Editor) readKey() (string, error) {
+	b, err := e.readByte()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case b == 27:
+		return e.readEscape()
+	case b == '\r':
+		return "enter", nil
+	case b == '\t':
+		return "tab", nil
+	case b == 127:
+		return "backspace", nil
+	case b == 0:
+		return "ctrl-space", nil
+	case b <= 26:
+		return "ctrl-" + string(rune('a'+b-1)), nil
+	case b < ' ':
+		return "", nil
+	case b < utf8.RuneSelf:
+		return string(rune(b)), nil
+	}
+
+	// The other bytes of a multibyte character follow the first one.
+	p := []byte{b}
+	for !utf8.FullRune(p) {
+		b, err := e.readByte()
+		if err != nil {
+			return "", err
+		}
+		p = append(p, b)
+	}
+
+	r, _ := utf8.DecodeRune(p)
+	if r == utf8.RuneError {
+		return "", nil
+	}
+	return string(r), nil
+}
+
+var csiKeys = map[byte]string{
+	'A': "up",
+	'B': "down",
+	'C': "right",
+	'D': "left",
+	'H': "home",
+	'F': "end",
+	'Z': "shift-tab",
+}
+
+var tildeKeys = map[string]string{
+	"1": "home",
+	"2": "insert",
+	"3": "delete",
+	"4": "end",
+	"5": "page-up",
+	"6": "page-down",
+	"7": "home",
+	"8": "end",
+}
+
+var modifiers = map[string]string{
+	"2": "shift-",
+	"3": "alt-",
+	"5": "ctrl-",
+}
+
+// readEscape reads the rest of an escape sequence. Escape alone is told from
+// the beginning of a sequence by the time until the next byte.
+func (e *Editor) readEscape() (string, error) {
+	fd := e.in.Fd()
+	if err := setTimeout(fd, 1); err != nil {
+		return "", err
+	}
+	defer setTimeout(fd, 0)
+
+	b, err := e.readByte()
+	if err == io.EOF {
+		return "escape", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch b {
+	case '[':
+		params := ""
+		for {
+			b, err := e.readByte()
+			if err != nil {
+				return "", nil
+			}
+			if b >= 0x40 && b <= 0x7e {
+				return csiKey(params, b), nil
+			}
+			params += string(rune(b))
+		}
+
+	case 'O':
+		b, err := e.readByte()
+		if err != nil {
+			return "", nil
+		}
+		return csiKeys[b], nil
+
+	case 27:
+		return "escape", nil
+
+	case 127:
+		return "alt-backspace", nil
+
+	case '\r':
+		return "alt-enter", nil
+	}
+
+	if b >= ' ' && b < utf8.RuneSelf {
+		return "alt-" + string(rune(b)), nil
+	}
+	return "", nil
+}
+
+// csiKey returns the key of the control sequence with params and final byte,
+// such as "1;5C" for ctrl-right.
+func csiKey(params string, final byte) string {
+	mod := ""
+	if i := len(params) - 2; i >= 0 && params[i] == ';' {
+		mod = modifiers[params[i+1:]]
+		params = params[:i]
+	}
+
+	key := csiKeys[final]
+	if final == '~' {
+		key = tildeKeys[params]
+	}
+	if key == "" {
+		return ""
+	}
+
+	return mod + key
+}
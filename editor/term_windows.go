@@ -0,0 +1,19 @@
+package editor
+
+import "errors"
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw mode is not supported")
+}
+
+func setTimeout(fd uintptr, d uint8) error {
+	return errors.New("raw mode is not supported")
+}
+
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func columns(fd uintptr) int {
+	return 80
+}
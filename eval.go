@@ -6,7 +6,6 @@ import (
 	"context"
 	"os"
 	"os/exec"
-	"os/signal"
 	"strings"
 
 	"github.com/w-haibara/lalash/parser"
@@ -18,10 +17,34 @@ func EvalString(ctx context.Context, cmd Command, expr string) error {
 		return err
 	}
 
+	return evalTokens(ctx, cmd, tokens)
+}
+
+// evalTokens evaluates the commands of tokens, which are separated by ";" or
+// "&".
+func evalTokens(ctx context.Context, cmd Command, tokens []parser.Token) error {
+	// Interrupts and traps are handled between commands.
+	next := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if cmd.signals != nil && cmd.job == nil {
+			return cmd.signals.runTraps(ctx)
+		}
+		return nil
+	}
+
 	start := 0
 	for i := 1; i <= len(tokens); i++ {
-		if tokens[i-1].Kind == parser.SeparateToken {
-			if err := eval(ctx, cmd, tokens[start:i-1]); err != nil {
+		if k := tokens[i-1].Kind; k == parser.SeparateToken || k == parser.BackgroundToken {
+			run := eval
+			if k == parser.BackgroundToken {
+				run = startJob
+			}
+			if err := next(); err != nil {
+				return err
+			}
+			if err := run(ctx, cmd, tokens[start:i-1]); err != nil {
 				return err
 			}
 			start = i
@@ -32,6 +55,9 @@ func EvalString(ctx context.Context, cmd Command, expr string) error {
 		}
 
 		if i == len(tokens) {
+			if err := next(); err != nil {
+				return err
+			}
 			if err := eval(ctx, cmd, tokens[start:i]); err != nil {
 				return err
 			}
@@ -78,10 +104,26 @@ func eval(ctx context.Context, cmd Command, tokens []parser.Token) error {
 
 			tokens[i].Val = res
 			tokens[i].Kind = parser.CommandToken
+			argv = append(argv, tokens[i].Val)
+			continue
 		}
+
+		if v.Kind == parser.CommandToken {
+			words, err := cmd.expandWord(v.Val)
+			if err != nil {
+				return err
+			}
+			argv = append(argv, words...)
+			continue
+		}
+
 		argv = append(argv, tokens[i].Val)
 	}
 
+	if len(argv) == 0 {
+		return nil
+	}
+
 	if err := Exec(ctx, cmd, argv); err != nil {
 		return err
 	}
@@ -90,19 +132,25 @@ func eval(ctx context.Context, cmd Command, tokens []parser.Token) error {
 }
 
 func Exec(ctx context.Context, cmd Command, argv []string) error {
-	if alias := cmd.Internal.GetAlias(argv[0]); alias != argv[0] {
-		str := ""
-		for i, v := range argv {
-			if i == 0 {
-				str += alias + " "
-				continue
-			}
-			str += v + " "
+	alias, err := cmd.Internal.GetAlias(argv[0])
+	if err != nil {
+		return err
+	}
+	if alias != argv[0] {
+		tokens, err := parser.Parse(alias)
+		if err != nil {
+			return err
 		}
 
-		EvalString(ctx, cmd, str)
+		// The arguments are passed as they are, not parsed again.
+		for _, v := range argv[1:] {
+			tokens = append(tokens, parser.Token{
+				Kind: parser.StringToken,
+				Val:  v,
+			})
+		}
 
-		return nil
+		return evalTokens(ctx, cmd, tokens)
 	}
 
 	if c, err := cmd.Internal.Get(argv[0]); err == nil {
@@ -112,28 +160,84 @@ func Exec(ctx context.Context, cmd Command, argv []string) error {
 		return nil
 	}
 	if err := func() error {
-		c := exec.CommandContext(ctx, argv[0], argv[1:]...)
-		c.Stdin = cmd.Stdin
-		c.Stdout = cmd.Stdout
-		c.Stderr = cmd.Stderr
-
-		sigc := make(chan os.Signal, 1024)
-		defer signal.Stop(sigc)
-
-		signal.Notify(sigc)
-		go func() {
-			for {
-				c.Process.Signal(<-sigc)
-			}
-		}()
+		if cmd.tty != nil && cmd.job == nil {
+			c := cmd.execCmd(context.Background(), argv)
+			return runForeground(ctx, cmd, c, strings.Join(argv, " "))
+		}
 
-		if err := c.Run(); err != nil {
-			return err
+		c := cmd.execCmd(ctx, argv)
+		if cmd.job != nil {
+			return cmd.job.run(c, cmd.tty)
 		}
 
-		return nil
+		// Without job control, the command shares the process group of
+		// the shell and receives the signals from the terminal by itself.
+		return c.Run()
 	}(); err != nil {
 		return err
 	}
 	return nil
 }
+
+// execCmd prepares argv to be run as an external command.
+func (cmd Command) execCmd(ctx context.Context, argv []string) *exec.Cmd {
+	c := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	c.Stdin = cmd.Stdin
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+
+	if pwd := cmd.wd.get(); pwd != "" {
+		c.Dir = pwd
+		c.Env = append(os.Environ(), "PWD="+pwd)
+	}
+
+	return c
+}
+
+// callFunc invokes fn with args. fn is either the name of a command, alias or
+// function, which receives args as its arguments, or a block, which is
+// evaluated in a new scope with args available through l-arg.
+func callFunc(ctx context.Context, cmd Command, fn string, args ...string) error {
+	fn = strings.TrimSpace(fn)
+
+	if strings.ContainsAny(fn, " \t\n") {
+		c, err := cmd.Internal.Get("l-eval")
+		if err != nil {
+			return err
+		}
+		return c.Fn(ctx, cmd, "l-eval", append([]string{fn}, args...)...)
+	}
+
+	alias, err := cmd.Internal.GetAlias(fn)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := parser.Parse(alias)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range args {
+		tokens = append(tokens, parser.Token{
+			Kind: parser.StringToken,
+			Val:  v,
+		})
+	}
+
+	return eval(ctx, cmd, tokens)
+}
+
+// callFuncOutput is like callFunc but returns the output of fn without its
+// trailing newline.
+func callFuncOutput(ctx context.Context, cmd Command, fn string, args ...string) (string, error) {
+	var b bytes.Buffer
+	c := cmd
+	c.Stdout = &b
+
+	if err := callFunc(ctx, c, fn, args...); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
@@ -0,0 +1,193 @@
+package lalash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GLOB_NOMATCH selects what happens to a pattern which matches nothing.
+const (
+	nomatchLiteral = "literal" // keep the pattern as is (default)
+	nomatchNull    = "null"    // remove the pattern
+	nomatchError   = "error"   // fail the command
+)
+
+func hasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// expandWord applies tilde expansion and filename globbing to an unquoted
+// word. A "~user" of an unknown user is kept as it is.
+func (cmd Command) expandWord(word string) ([]string, error) {
+	w, err := expandTilde(word)
+	if err != nil {
+		w = word
+	}
+
+	if !hasGlobMeta(w) {
+		return []string{w}, nil
+	}
+
+	matches, err := cmd.glob(w)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matches) > 0 {
+		return matches, nil
+	}
+
+	nomatch, _ := cmd.Internal.loadVar("GLOB_NOMATCH")
+	switch nomatch {
+	case "", nomatchLiteral:
+		return []string{word}, nil
+	case nomatchNull:
+		return []string{}, nil
+	case nomatchError:
+		return nil, fmt.Errorf("no matches found: %v", word)
+	}
+
+	return nil, fmt.Errorf("invalid GLOB_NOMATCH: %v", nomatch)
+}
+
+type globMatch struct {
+	display string
+	abs     string
+}
+
+func (m globMatch) join(name string) globMatch {
+	display := name
+	switch m.display {
+	case "":
+	case "/":
+		display = "/" + name
+	default:
+		display = m.display + "/" + name
+	}
+
+	return globMatch{
+		display: display,
+		abs:     filepath.Join(m.abs, name),
+	}
+}
+
+// globTree returns m and every directory below it. When files is set, it
+// returns every file and directory below m instead.
+func globTree(m globMatch, files bool) []globMatch {
+	res := []globMatch{}
+	if !files {
+		res = append(res, m)
+	}
+
+	entries, err := os.ReadDir(m.abs)
+	if err != nil {
+		return res
+	}
+
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		c := m.join(e.Name())
+		if files {
+			res = append(res, c)
+		}
+		if e.IsDir() {
+			res = append(res, globTree(c, files)...)
+		}
+	}
+
+	return res
+}
+
+// glob expands pattern relative to the working directory of the shell. In
+// addition to the syntax of filepath.Match, "**" matches any number of
+// directories. Hidden files are matched only by patterns starting with ".".
+func (cmd Command) glob(pattern string) ([]string, error) {
+	segs := strings.Split(pattern, "/")
+
+	cur := []globMatch{}
+	if filepath.IsAbs(pattern) {
+		cur = append(cur, globMatch{display: "/", abs: "/"})
+		segs = segs[1:]
+	} else {
+		wd, err := cmd.absPath(".")
+		if err != nil {
+			return nil, err
+		}
+		cur = append(cur, globMatch{display: "", abs: wd})
+	}
+
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		next := []globMatch{}
+
+		switch {
+		case seg == "":
+			if !last {
+				continue
+			}
+			for _, m := range cur {
+				if info, err := os.Stat(m.abs); err == nil && info.IsDir() {
+					next = append(next, globMatch{display: m.display + "/", abs: m.abs})
+				}
+			}
+
+		case seg == "**":
+			for _, m := range cur {
+				next = append(next, globTree(m, last)...)
+			}
+
+		case !hasGlobMeta(seg):
+			for _, m := range cur {
+				c := m.join(seg)
+				if _, err := os.Lstat(c.abs); err == nil {
+					next = append(next, c)
+				}
+			}
+
+		default:
+			// A malformed pattern matches nothing, and is kept as a word
+			// like the other patterns which match nothing.
+			if _, err := filepath.Match(seg, ""); err != nil {
+				return []string{}, nil
+			}
+
+			for _, m := range cur {
+				entries, err := os.ReadDir(m.abs)
+				if err != nil {
+					continue
+				}
+
+				for _, e := range entries {
+					if strings.HasPrefix(e.Name(), ".") && !strings.HasPrefix(seg, ".") {
+						continue
+					}
+
+					if ok, _ := filepath.Match(seg, e.Name()); ok {
+						next = append(next, m.join(e.Name()))
+					}
+				}
+			}
+		}
+
+		cur = next
+	}
+
+	seen := map[string]bool{}
+	res := []string{}
+	for _, m := range cur {
+		if m.display == "" || seen[m.display] {
+			continue
+		}
+		seen[m.display] = true
+		res = append(res, m.display)
+	}
+	sort.Strings(res)
+
+	return res, nil
+}
@@ -6,5 +6,5 @@ require (
 	github.com/k0kubun/colorstring v0.0.0-20150214042306-9440f1994b88 // indirect
 	github.com/k0kubun/pp v3.0.1+incompatible
 	github.com/mattn/go-colorable v0.1.8 // indirect
-	github.com/peterh/liner v1.2.1
+	github.com/mattn/go-runewidth v0.0.3
 )
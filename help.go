@@ -0,0 +1,274 @@
+package lalash
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Flag is a flag of an internal command. The type of its default value is
+// the type of the flag: bool, int, string or time.Duration.
+type Flag struct {
+	Name  string // without the dashes, such as "n" or "mut"
+	Value interface{}
+	Arg   string // the name of the value in the help, such as "count"
+	Usage string
+}
+
+// String returns the flag as it is written, such as "-n" or "--mut".
+func (fl Flag) String() string {
+	if len(fl.Name) == 1 {
+		return "-" + fl.Name
+	}
+	return "--" + fl.Name
+}
+
+// arg returns the name of the value of the flag, or "" for a bool flag.
+func (fl Flag) arg() string {
+	if fl.Arg != "" {
+		return fl.Arg
+	}
+
+	switch fl.Value.(type) {
+	case bool:
+		return ""
+	case int:
+		return "n"
+	case time.Duration:
+		return "duration"
+	default:
+		return "value"
+	}
+}
+
+// flagNames returns the flags of the command as they are written, for
+// completion.
+func (c InternalCmd) flagNames() []string {
+	names := []string{}
+	for _, fl := range c.Flags {
+		names = append(names, fl.String())
+	}
+	return names
+}
+
+// flagSet returns a flag set which parses the flags of the command.
+func (c InternalCmd) flagSet(name string) *flag.FlagSet {
+	f := flag.NewFlagSet(name, flag.ContinueOnError)
+	f.SetOutput(io.Discard)
+
+	for _, fl := range c.Flags {
+		switch v := fl.Value.(type) {
+		case bool:
+			f.Bool(fl.Name, v, fl.Usage)
+		case int:
+			f.Int(fl.Name, v, fl.Usage)
+		case string:
+			f.String(fl.Name, v, fl.Usage)
+		case time.Duration:
+			f.Duration(fl.Name, v, fl.Usage)
+		default:
+			panic(fmt.Sprintf("%v: invalid type of the flag %v: %T", name, fl, v))
+		}
+	}
+
+	return f
+}
+
+// parseFlags parses argv with the flags of the internal command name. With
+// -h, the help of the command is shown.
+func (cmd Command) parseFlags(name string, argv []string) (*flag.FlagSet, error) {
+	c, err := cmd.Internal.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+
+	f := c.flagSet(name)
+	if err := f.Parse(argv); err != nil {
+		if err == flag.ErrHelp {
+			writeHelp(cmd.Stderr, name, c)
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func flagValue(f *flag.FlagSet, name string) interface{} {
+	return f.Lookup(name).Value.(flag.Getter).Get()
+}
+
+func flagBool(f *flag.FlagSet, name string) bool {
+	return flagValue(f, name).(bool)
+}
+
+func flagInt(f *flag.FlagSet, name string) int {
+	return flagValue(f, name).(int)
+}
+
+func flagString(f *flag.FlagSet, name string) string {
+	return flagValue(f, name).(string)
+}
+
+func flagDuration(f *flag.FlagSet, name string) time.Duration {
+	return flagValue(f, name).(time.Duration)
+}
+
+// family returns the family of the command name, which is the part before
+// the first "-".
+func family(name string) string {
+	if i := strings.Index(name, "-"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// summary returns the first line of the description of the command.
+func (c InternalCmd) summary() string {
+	return strings.SplitN(c.Desc, "\n", 2)[0]
+}
+
+// matches reports whether text is in the name or the documentation of the
+// command, ignoring case.
+func (c InternalCmd) matches(name, text string) bool {
+	text = strings.ToLower(text)
+
+	docs := []string{name, c.Synopsis, c.Desc}
+	for _, fl := range c.Flags {
+		docs = append(docs, fl.Usage)
+	}
+	for _, v := range docs {
+		if strings.Contains(strings.ToLower(v), text) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeHelp writes the synopsis, the description, the flags and the
+// examples of the command name.
+func writeHelp(w io.Writer, name string, c InternalCmd) {
+	synopsis := c.Synopsis
+	if synopsis == "" {
+		synopsis = name
+	}
+	fmt.Fprintln(w, "Usage:", synopsis)
+
+	if c.Desc != "" {
+		fmt.Fprintf(w, "\n%v\n", c.Desc)
+	}
+
+	if len(c.Flags) > 0 {
+		fmt.Fprintln(w, "\nFlags:")
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for _, fl := range c.Flags {
+			s := fl.String()
+			if a := fl.arg(); a != "" {
+				s += " " + a
+			}
+
+			usage := fl.Usage
+			switch v := fl.Value.(type) {
+			case string:
+				if v != "" {
+					usage += fmt.Sprintf(" (default %q)", v)
+				}
+			case int:
+				if v != 0 {
+					usage += fmt.Sprintf(" (default %v)", v)
+				}
+			case time.Duration:
+				if v != 0 {
+					usage += fmt.Sprintf(" (default %v)", v)
+				}
+			}
+			fmt.Fprintf(tw, "  %v\t%v\n", s, usage)
+		}
+		tw.Flush()
+	}
+
+	if len(c.Examples) > 0 {
+		fmt.Fprintln(w, "\nExamples:")
+		for _, v := range c.Examples {
+			fmt.Fprintln(w, "  "+v)
+		}
+	}
+}
+
+func (cmd Command) setInternalHelpFamily() {
+	cmd.Internal.Cmds.Store("l-help", InternalCmd{
+		Synopsis: "l-help [command] | [--family name] [--search text]",
+		Desc: "Shows the documentation of an internal command, or lists the commands.\n" +
+			"The commands are listed by family, which is the prefix of their names such as \"s\" of s-split.",
+		Flags: []Flag{
+			{Name: "family", Value: "", Arg: "name", Usage: "list the commands of the family"},
+			{Name: "search", Value: "", Arg: "text", Usage: "list the commands whose names or documentation contain text"},
+		},
+		Examples: []string{
+			"l-help l-var",
+			"l-help --family s",
+			"l-help --search json",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-help", argv)
+			if err != nil {
+				return err
+			}
+			fam := flagString(f, "family")
+			search := flagString(f, "search")
+
+			if f.NArg() > 0 {
+				c, err := cmd.Internal.Get(f.Arg(0))
+				if err != nil {
+					return fmt.Errorf("%v: %v", f.Arg(0), err)
+				}
+				writeHelp(cmd.Stdout, f.Arg(0), c)
+				return nil
+			}
+
+			names := []string{}
+			cmd.Internal.Cmds.Range(func(key, value interface{}) bool {
+				name := key.(string)
+				if fam != "" && family(name) != fam {
+					return true
+				}
+				if search != "" && !value.(InternalCmd).matches(name, search) {
+					return true
+				}
+				names = append(names, name)
+				return true
+			})
+			sort.Slice(names, func(i, j int) bool {
+				if fi, fj := family(names[i]), family(names[j]); fi != fj {
+					return fi < fj
+				}
+				return names[i] < names[j]
+			})
+
+			if len(names) == 0 {
+				switch {
+				case search != "":
+					return fmt.Errorf("no commands match: %v", search)
+				default:
+					return fmt.Errorf("invalid family: %v", fam)
+				}
+			}
+
+			tw := tabwriter.NewWriter(cmd.Stdout, 0, 8, 1, ' ', 0)
+			for i, name := range names {
+				if i > 0 && family(name) != family(names[i-1]) {
+					fmt.Fprintln(tw)
+				}
+				c, _ := cmd.Internal.Get(name)
+				fmt.Fprintf(tw, "%v\t: %v\n", name, c.summary())
+			}
+
+			return tw.Flush()
+		},
+	})
+}
@@ -0,0 +1,95 @@
+package lalash
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/w-haibara/lalash/parser"
+)
+
+// The types of the commands, in the order they are looked up.
+const (
+	cmdTypeAlias    = "alias"
+	cmdTypeFunction = "function"
+	cmdTypeBuiltin  = "builtin"
+	cmdTypeFile     = "file"
+)
+
+// commandType returns the type of the command name, or "" if there is no
+// such command.
+func (cmd Command) commandType(name string) string {
+	if v, ok := cmd.Internal.Alias.Load(name); ok {
+		if isFunc(v.(string)) {
+			return cmdTypeFunction
+		}
+		return cmdTypeAlias
+	}
+
+	if _, ok := cmd.Internal.Cmds.Load(name); ok {
+		return cmdTypeBuiltin
+	}
+
+	if strings.ContainsRune(name, '/') {
+		p, err := cmd.absPath(name)
+		if err != nil {
+			return ""
+		}
+		if info, err := os.Stat(p); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return cmdTypeFile
+		}
+		return ""
+	}
+
+	if _, err := exec.LookPath(name); err == nil {
+		return cmdTypeFile
+	}
+
+	return ""
+}
+
+// highlightColors are the colors of the spans of a line in the REPL, and of
+// the commands by their types. A command which is not found is "unknown".
+var highlightColors = map[string]string{
+	parser.StringSpan:       "yellow",
+	parser.BlockSpan:        "magenta",
+	parser.SubstitutionSpan: "blue",
+	parser.CommentSpan:      "dim",
+	parser.ErrorSpan:        "red,underline",
+	cmdTypeAlias:            "cyan",
+	cmdTypeFunction:         "cyan",
+	cmdTypeBuiltin:          "cyan",
+	cmdTypeFile:             "green",
+	"unknown":               "red",
+}
+
+// highlight colors line as it is typed in the REPL.
+func (cmd Command) highlight(line string) string {
+	r := []rune(line)
+
+	var b strings.Builder
+	last := 0
+	for _, s := range parser.Lex(line) {
+		text := string(r[s.Start:s.End])
+
+		kind := s.Kind
+		if kind == parser.CommandSpan {
+			kind = cmd.commandType(text)
+			if kind == "" {
+				kind = "unknown"
+			}
+		}
+
+		code, err := ansiCode(highlightColors[kind])
+		if highlightColors[kind] == "" || err != nil {
+			continue
+		}
+
+		b.WriteString(string(r[last:s.Start]))
+		b.WriteString(code + text + "\x1b[0m")
+		last = s.End
+	}
+	b.WriteString(string(r[last:]))
+
+	return b.String()
+}
@@ -1,34 +1,344 @@
 package history
 
 import (
+	"bufio"
+	"encoding/json"
 	"os"
 	"path/filepath"
-
-	"github.com/peterh/liner"
+	"strings"
+	"sync"
+	"time"
 )
 
-type HistoryFileName string
+// DefaultSize is the number of entries kept when no size is given.
+const DefaultSize = 1000
+
+// Entry is a command line in the history.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Cwd    string    `json:"cwd,omitempty"`
+	Status int       `json:"status"`
+	Line   string    `json:"line"`
+}
+
+// Options control which lines are added to the history.
+type Options struct {
+	IgnoreDups  bool // do not add a line equal to the previous one
+	IgnoreSpace bool // do not add a line starting with a space
+	EraseDups   bool // remove the older entries equal to a new line
+}
+
+// History is the command history of a shell. Each entry is appended to its
+// file as soon as it is added, so that it survives a crash of the shell.
+type History struct {
+	mu      sync.Mutex
+	path    string
+	size    int
+	lines   int // number of lines in the file
+	entries []Entry
+
+	all   *index            // the lines of all the entries
+	byCwd map[string]*index // the lines of the entries in each directory
+}
+
+// DefaultPath returns the history file in the XDG state directory.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "lalash", "history")
+}
+
+// Open loads the history in the file at path, which is created when the
+// first entry is added. An empty path keeps the history in memory only.
+func Open(path string, size int) (*History, error) {
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	h := &History{
+		path: path,
+		size: size,
+	}
+
+	if path == "" {
+		h.reindex()
+		return h, nil
+	}
+
+	entries, err := readFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	h.lines = len(entries)
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	h.entries = entries
+	h.reindex()
+
+	return h, nil
+}
+
+// reindex builds the indexes of the lines again, after entries are removed.
+func (h *History) reindex() {
+	h.all = newIndex()
+	h.byCwd = map[string]*index{}
+	for _, e := range h.entries {
+		h.index(e)
+	}
+}
+
+func (h *History) index(e Entry) {
+	h.all.add(e.Line)
+
+	x, ok := h.byCwd[e.Cwd]
+	if !ok {
+		x = newIndex()
+		h.byCwd[e.Cwd] = x
+	}
+	x.add(e.Line)
+}
+
+// Suggest returns the newest line which begins with prefix and is longer. If
+// cwd is not "", only the lines run in the directory cwd are looked up.
+func (h *History) Suggest(prefix, cwd string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	x := h.all
+	if cwd != "" {
+		x = h.byCwd[cwd]
+	}
+	if x == nil {
+		return "", false
+	}
+
+	return x.find(prefix)
+}
+
+// readFile reads the entries in the file at path. A line which is not an
+// entry, such as one of a history file of an older version, is read as a
+// command line without the other fields.
+func readFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []Entry{}
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		text := s.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		var e Entry
+		if err := json.Unmarshal([]byte(text), &e); err != nil || e.Line == "" {
+			e = Entry{Line: text}
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, s.Err()
+}
+
+// Path returns the file of the history.
+func (h *History) Path() string {
+	return h.path
+}
+
+// Entries returns the entries from the oldest one.
+func (h *History) Entries() []Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]Entry{}, h.entries...)
+}
+
+// Add adds e to the history and appends it to the file. It reports whether
+// e was added, which it is not if opts filter it out.
+func (h *History) Add(e Entry, opts Options) (bool, error) {
+	if strings.TrimSpace(e.Line) == "" {
+		return false, nil
+	}
+	if opts.IgnoreSpace && strings.HasPrefix(e.Line, " ") {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if opts.IgnoreDups && len(h.entries) > 0 && h.entries[len(h.entries)-1].Line == e.Line {
+		return false, nil
+	}
+
+	erased, trimmed := false, false
+	if opts.EraseDups {
+		n := len(h.entries)
+		h.entries = eraseLine(h.entries, e.Line)
+		erased = len(h.entries) < n
+	}
+
+	h.entries = append(h.entries, e)
+	if len(h.entries) > h.size {
+		h.entries = h.entries[len(h.entries)-h.size:]
+		trimmed = true
+	}
+
+	if erased || trimmed {
+		h.reindex()
+	} else {
+		h.index(e)
+	}
+
+	if h.path == "" {
+		return true, nil
+	}
+
+	// The file grows until it has twice as many lines as are kept, and is
+	// then rewritten.
+	if erased || h.lines >= 2*h.size {
+		return true, h.rewrite(func(entries []Entry) []Entry {
+			if opts.EraseDups {
+				entries = eraseLine(entries, e.Line)
+			}
+			return append(entries, e)
+		})
+	}
+
+	return true, h.append(e)
+}
+
+// Delete removes the entry at index i, counted from 0 for the oldest one.
+func (h *History) Delete(i int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i < 0 || i >= len(h.entries) {
+		return os.ErrNotExist
+	}
+	d := h.entries[i]
+	h.entries = append(h.entries[:i], h.entries[i+1:]...)
+	h.reindex()
+
+	if h.path == "" {
+		return nil
+	}
+
+	return h.rewrite(func(entries []Entry) []Entry {
+		for j := len(entries) - 1; j >= 0; j-- {
+			if sameEntry(entries[j], d) {
+				return append(entries[:j], entries[j+1:]...)
+			}
+		}
+		return entries
+	})
+}
 
-func New(name string) HistoryFileName {
-	return HistoryFileName(name)
+// eraseLine removes the entries of line.
+func eraseLine(entries []Entry, line string) []Entry {
+	res := entries[:0]
+	for _, v := range entries {
+		if v.Line != line {
+			res = append(res, v)
+		}
+	}
+	return res
 }
 
-func (fn HistoryFileName) ReadHistory(line *liner.State) error {
-	f, err := os.Open(filepath.Join(os.TempDir(), string(fn)))
+func sameEntry(a, b Entry) bool {
+	return a.Time.Equal(b.Time) && a.Cwd == b.Cwd && a.Status == b.Status && a.Line == b.Line
+}
+
+func (h *History) append(e Entry) error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockFile(h.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
 	if err != nil {
 		return err
 	}
-	line.ReadHistory(f)
-	f.Close()
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	h.lines++
+
 	return nil
 }
 
-func (fn HistoryFileName) WriteHistory(line *liner.State) error {
-	f, err := os.Create(filepath.Join(os.TempDir(), string(fn)))
+// rewrite replaces the file with its entries changed by edit, keeping the
+// newest ones up to the size of the history. The file is read again under
+// the lock, so that the lines appended by other shells are not lost.
+func (h *History) rewrite(edit func([]Entry) []Entry) error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+
+	unlock, err := lockFile(h.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := readFile(h.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	entries = edit(entries)
+	if len(entries) > h.size {
+		entries = entries[len(entries)-h.size:]
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(h.path), ".history-*")
 	if err != nil {
 		return err
 	}
-	line.WriteHistory(f)
-	f.Close()
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(b, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), h.path); err != nil {
+		return err
+	}
+	h.lines = len(entries)
+
 	return nil
 }
@@ -0,0 +1,39 @@
+package history
+
+// index finds the newest line which begins with a prefix and is longer. It is
+// a trie of the lines where each node keeps the newest line going on past it.
+type index struct {
+	longer   string
+	children map[rune]*index
+}
+
+func newIndex() *index {
+	return &index{children: map[rune]*index{}}
+}
+
+// add adds line, which is newer than the lines added before.
+func (x *index) add(line string) {
+	n := x
+	for _, r := range line {
+		n.longer = line
+		c, ok := n.children[r]
+		if !ok {
+			c = newIndex()
+			n.children[r] = c
+		}
+		n = c
+	}
+}
+
+// find returns the newest line which begins with prefix and is longer.
+func (x *index) find(prefix string) (string, bool) {
+	n := x
+	for _, r := range prefix {
+		c, ok := n.children[r]
+		if !ok {
+			return "", false
+		}
+		n = c
+	}
+	return n.longer, n.longer != ""
+}
@@ -0,0 +1,39 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// staleLock is the age after which a lock is taken to be left by a shell
+// which crashed while holding it.
+const staleLock = 10 * time.Second
+
+// lockFile locks the file at path among the shells sharing it, by creating
+// path+".lock". It returns a function which releases the lock.
+func lockFile(path string) (func(), error) {
+	lock := path + ".lock"
+	deadline := time.Now().Add(2 * staleLock)
+
+	for {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(lock)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, errors.New("history file is locked: " + lock)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
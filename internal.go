@@ -3,20 +3,25 @@ package lalash
 import (
 	"bytes"
 	"context"
-	"flag"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+
+	"github.com/w-haibara/lalash/parser"
 )
 
+// InternalCmd is a command of the shell. Its documentation is shown by
+// l-help, and its flags are parsed with parseFlags.
 type InternalCmd struct {
-	Usage string
-	Fn    func(context.Context, Command, string, ...string) error
+	Synopsis string // such as "l-echo [--fd n] [args...]"
+	Desc     string // a summary on the first line, and the details after it
+	Flags    []Flag
+	Examples []string
+	Fn       func(context.Context, Command, string, ...string) error
 }
 
 type Internal struct {
@@ -28,6 +33,15 @@ type Internal struct {
 	GlobalVar    *sync.Map
 	Args         *sync.Map
 	Return       *sync.Map
+	Regexp       *sync.Map
+	Jobs         *sync.Map
+	Traps        *sync.Map
+	Tasks        *sync.Map
+	Chans        *sync.Map
+	Modules      *sync.Map
+	Imports      *sync.Map
+	Completions  *sync.Map
+	FuncPos      *sync.Map
 }
 
 func NewInternal() Internal {
@@ -40,6 +54,15 @@ func NewInternal() Internal {
 		GlobalVar:    new(sync.Map),
 		Args:         new(sync.Map),
 		Return:       new(sync.Map),
+		Regexp:       new(sync.Map),
+		Jobs:         new(sync.Map),
+		Traps:        new(sync.Map),
+		Tasks:        new(sync.Map),
+		Chans:        new(sync.Map),
+		Modules:      new(sync.Map),
+		Imports:      new(sync.Map),
+		Completions:  new(sync.Map),
+		FuncPos:      new(sync.Map),
 	}
 	return in
 }
@@ -55,6 +78,21 @@ func checkArgv(argv []string, n int) error {
 	return nil
 }
 
+// subject returns argv[n], or the whole of stdin without its trailing newline
+// when the argument is omitted.
+func subject(cmd Command, argv []string, n int) (string, error) {
+	if len(argv) > n {
+		return argv[n], nil
+	}
+
+	b, err := io.ReadAll(cmd.Stdin)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
 func (i Internal) GetAliasAll() []string {
 	var s []string
 	i.Alias.Range(func(key, value interface{}) bool {
@@ -64,11 +102,74 @@ func (i Internal) GetAliasAll() []string {
 	return s
 }
 
-func (i Internal) GetAlias(args string) string {
-	if v, ok := i.Alias.Load(args); ok {
-		return i.GetAlias(v.(string))
+// GetAlias returns the command which the alias args expands to, following
+// the aliases which expand to other aliases. It fails if the aliases expand to
+// each other in a cycle.
+func (i Internal) GetAlias(args string) (string, error) {
+	if _, err := i.aliasChain(args); err != nil {
+		return "", err
+	}
+
+	for {
+		v, ok := i.Alias.Load(args)
+		if !ok {
+			return args, nil
+		}
+		args = v.(string)
+	}
+}
+
+// aliasChain returns the aliases which run when name is run as a command,
+// from name itself. An alias leads to the next one when its first word is
+// another alias, and a function ends the chain.
+func (i Internal) aliasChain(name string) ([]string, error) {
+	chain := []string{}
+	seen := map[string]bool{}
+	for {
+		v, ok := i.Alias.Load(name)
+		if !ok {
+			return chain, nil
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("alias cycle: %v -> %v", strings.Join(chain, " -> "), name)
+		}
+		seen[name] = true
+		chain = append(chain, name)
+
+		if isFunc(v.(string)) {
+			return chain, nil
+		}
+
+		name = firstWord(v.(string))
+	}
+}
+
+// isFunc reports whether the value of an alias is the body of a function
+// defined with l-fn, or calls a function of a module.
+func isFunc(alias string) bool {
+	if _, _, ok := moduleFunc(alias); ok {
+		return true
 	}
-	return args
+	return strings.HasPrefix(alias, "l-eval {") && strings.HasSuffix(alias, "}")
+}
+
+// firstWord returns the command word of the expression expr, or "" if it has
+// none.
+func firstWord(expr string) string {
+	tokens, err := parser.Parse(expr)
+	if err != nil {
+		return ""
+	}
+	for _, v := range tokens {
+		if v.Kind == parser.SeparateToken || v.Kind == parser.BackgroundToken {
+			return ""
+		}
+		if strings.TrimSpace(v.Val) != "" {
+			return v.Val
+		}
+	}
+	return ""
 }
 
 func (i Internal) GetCmdsAll() []string {
@@ -111,42 +212,32 @@ func sortJoin(s []string) string {
 }
 
 func (cmd Command) setInternalUtilFamily() {
-	cmd.Internal.Cmds.Store("l-help", InternalCmd{
-		Usage: "l-help",
-		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			var s []string
-			cmd.Internal.Cmds.Range(func(key, value interface{}) bool {
-				s = append(s, fmt.Sprintln(key, ":", value.(InternalCmd).Usage))
-				return true
-			})
-			sort.Strings(s)
-			ret := ""
-			for _, v := range s {
-				ret += v
-			}
-			fmt.Fprintln(cmd.Stdout, ret)
-			return nil
-		},
-	})
-
 	cmd.Internal.Cmds.Store("l-echo", InternalCmd{
-		Usage: "l-echo",
+		Synopsis: "l-echo [--fd n] [args...]",
+		Desc:     "Writes the arguments to the standard output, separated by spaces.",
+		Flags: []Flag{
+			{Name: "fd", Value: 1, Arg: "n", Usage: "write to the file descriptor n, which is 1, 2 or one passed by l-pipe"},
+		},
+		Examples: []string{
+			"l-echo hello world",
+			"l-echo --fd 2 \"an error\"",
+		},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			f := flag.NewFlagSet("echo", flag.ContinueOnError)
-			fd := f.Int("fd", 1, "")
-			if err := f.Parse(argv); err != nil {
+			f, err := cmd.parseFlags("l-echo", argv)
+			if err != nil {
 				return err
 			}
+			fd := flagInt(f, "fd")
 
 			out := cmd.Stdout
 			switch {
-			case *fd == 1:
-			case *fd == 2:
+			case fd == 1:
+			case fd == 2:
 				out = cmd.Stderr
-			case *fd >= 3:
-				out = cmd.ExtraFiles[*fd-3]
+			case fd >= 3:
+				out = cmd.ExtraFiles[fd-3]
 			default:
-				return fmt.Errorf("invalid fd: %v", *fd)
+				return fmt.Errorf("invalid fd: %v", fd)
 			}
 			fmt.Fprintln(out, strings.Join(f.Args(), " "))
 			return nil
@@ -154,22 +245,27 @@ func (cmd Command) setInternalUtilFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("l-cat", InternalCmd{
-		Usage: "l-cat",
+		Synopsis: "l-cat [--fd n]",
+		Desc:     "Copies the standard input to the standard output.",
+		Flags: []Flag{
+			{Name: "fd", Value: 0, Arg: "n", Usage: "read from the file descriptor n, which is 0 or one passed by l-pipe"},
+		},
+		Examples: []string{"l-pipe {l-echo abc} l-cat"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			f := flag.NewFlagSet("cat", flag.ContinueOnError)
-			fd := f.Int("fd", 0, "")
-			if err := f.Parse(argv); err != nil {
+			f, err := cmd.parseFlags("l-cat", argv)
+			if err != nil {
 				return err
 			}
+			fd := flagInt(f, "fd")
 
 			var src io.Reader
 			switch {
-			case *fd == 0:
+			case fd == 0:
 				src = cmd.Stdin
-			case *fd >= 3:
-				src = cmd.ExtraFiles[*fd-3]
+			case fd >= 3:
+				src = cmd.ExtraFiles[fd-3]
 			default:
-				return fmt.Errorf("invalid fd: %v", *fd)
+				return fmt.Errorf("invalid fd: %v", fd)
 			}
 
 			if _, err := io.Copy(cmd.Stdout, src); err != nil {
@@ -180,30 +276,54 @@ func (cmd Command) setInternalUtilFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("l-cd", InternalCmd{
-		Usage: "l-cd <path>",
+		Synopsis: "l-cd [path | -]",
+		Desc: "Changes the working directory.\n" +
+			"Without a path, it changes to the home directory, and with \"-\", to the previous one. A relative path is looked up in the directories of CDPATH, and the directory is shown when it was found there.",
+		Examples: []string{
+			"l-cd /tmp",
+			"l-cd -",
+		},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			if err := checkArgv(argv, 1); err != nil {
+			name := ""
+			if len(argv) > 0 {
+				name = argv[0]
+			}
+
+			dir, found, err := cmd.cdTarget(name)
+			if err != nil {
 				return err
 			}
-			if err := os.Chdir(argv[0]); err != nil {
+
+			if err := cmd.wd.chdir(dir); err != nil {
 				return err
 			}
+
+			// As in other shells, the directory is shown when it is not
+			// the one given.
+			if found {
+				fmt.Fprintln(cmd.Stdout, dir)
+			}
+
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("l-exit", InternalCmd{
-		Usage: "l-exit",
+		Synopsis: "l-exit",
+		Desc:     "Exits the shell.",
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			return shellExitErr
 		},
 	})
 
 	cmd.Internal.Cmds.Store("l-fn", InternalCmd{
-		Usage: "l-fn",
+		Synopsis: "l-fn <name> {body}",
+		Desc: "Defines a function, which runs body with its arguments.\n" +
+			"The arguments are read with l-arg and l-args, and values are returned with l-return.",
+		Examples: []string{"l-fn greet {l-echo hello (l-arg 0)}; greet world"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			f := flag.NewFlagSet("fn", flag.ContinueOnError)
-			if err := f.Parse(argv); err != nil {
+			f, err := cmd.parseFlags("l-fn", argv)
+			if err != nil {
 				return err
 			}
 
@@ -220,13 +340,20 @@ func (cmd Command) setInternalUtilFamily() {
 			}
 
 			cmd.Internal.Alias.Store(f.Arg(0), "l-eval {"+f.Arg(1)+"}")
+			if pos, ok := sourcePosOf(ctx); ok {
+				cmd.Internal.FuncPos.Store(f.Arg(0), pos)
+			} else {
+				cmd.Internal.FuncPos.Delete(f.Arg(0))
+			}
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("l-arg", InternalCmd{
-		Usage: "l-arg",
+		Synopsis: "l-arg <n>",
+		Desc:     "Prints the nth argument of the function, counted from 0.",
+		Examples: []string{"l-fn first {l-arg 0}; first a b"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 1); err != nil {
 				return err
@@ -244,7 +371,8 @@ func (cmd Command) setInternalUtilFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("l-args", InternalCmd{
-		Usage: "l-args",
+		Synopsis: "l-args",
+		Desc:     "Prints the arguments of the function, one on each line.",
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			for i := 0; ; i++ {
 				if v, ok := cmd.Internal.Args.Load(i); ok {
@@ -261,7 +389,9 @@ func (cmd Command) setInternalUtilFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("l-return", InternalCmd{
-		Usage: "l-return",
+		Synopsis: "l-return [values...]",
+		Desc:     "Returns from the function with values, which are printed by l-return-val.",
+		Examples: []string{"l-fn f {l-return a b}; f; l-return-val"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			for i, v := range argv {
 				cmd.Internal.Return.Store(i, v)
@@ -272,7 +402,8 @@ func (cmd Command) setInternalUtilFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("l-return-val", InternalCmd{
-		Usage: "l-return-val",
+		Synopsis: "l-return-val",
+		Desc:     "Prints the values returned by the last function, one on each line.",
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			for i := 0; ; i++ {
 				if v, ok := cmd.Internal.Return.Load(i); ok {
@@ -291,21 +422,30 @@ func (cmd Command) setInternalUtilFamily() {
 
 func (cmd Command) setInternalAliasFamily() {
 	cmd.Internal.Cmds.Store("l-alias", InternalCmd{
-		Usage: "",
+		Synopsis: "l-alias <name> <command> | --unset <name> | --show",
+		Desc:     "Defines an alias, which is replaced by command when it is run as a command.",
+		Flags: []Flag{
+			{Name: "unset", Value: false, Usage: "remove the alias name"},
+			{Name: "show", Value: false, Usage: "list the aliases"},
+		},
+		Examples: []string{
+			"l-alias ll {f-ls -l}",
+			"l-alias --unset ll",
+		},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			f := flag.NewFlagSet("alias", flag.ContinueOnError)
-			isUnset := f.Bool("unset", false, "")
-			isShow := f.Bool("show", false, "")
-			if err := f.Parse(argv); err != nil {
+			f, err := cmd.parseFlags("l-alias", argv)
+			if err != nil {
 				return err
 			}
+			isUnset := flagBool(f, "unset")
+			isShow := flagBool(f, "show")
 
-			if *isUnset && *isShow {
+			if isUnset && isShow {
 				return fmt.Errorf("cannot set both --unset and --show.")
 			}
 
 			switch {
-			case !*isUnset && !*isShow:
+			case !isUnset && !isShow:
 				if f.Arg(0) == "" {
 					return fmt.Errorf("key is blank")
 				}
@@ -313,16 +453,18 @@ func (cmd Command) setInternalAliasFamily() {
 					return fmt.Errorf("value is blank")
 				}
 				cmd.Internal.Alias.Store(f.Arg(0), f.Arg(1))
+				cmd.Internal.FuncPos.Delete(f.Arg(0))
 				return nil
 
-			case *isUnset:
+			case isUnset:
 				if f.Arg(0) == "" {
 					return fmt.Errorf("key is blank")
 				}
 				cmd.Internal.Alias.Delete(f.Arg(0))
+				cmd.Internal.FuncPos.Delete(f.Arg(0))
 				return nil
 
-			case *isShow:
+			case isShow:
 				s := []string{}
 				cmd.Internal.Alias.Range(func(key, value interface{}) bool {
 					s = append(s, fmt.Sprintf("%v : %v", key, value))
@@ -342,90 +484,143 @@ func storeVarToMap(m *sync.Map, name, value string) {
 	m.Store(name, value)
 }
 
+// varString returns the string of the value of a variable.
+func varString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case jsonVar:
+		return v.s, true
+	}
+	return "", false
+}
+
 func loadVarFromMap(m *sync.Map, name string) (string, bool) {
 	if v, ok := m.Load(name); ok {
-		if v, ok := v.(string); ok {
-			return v, true
-		}
+		return varString(v)
 	}
 	return "", false
 }
 
-func (cmd Command) setInternalVarFamily() {
-	cmd.Internal.SetInternalCmd("l-var", InternalCmd{
-		Usage: "l-var",
-		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+func (i Internal) loadVar(name string) (string, bool) {
+	if v, ok := loadVarFromMap(i.Var, name); ok {
+		return v, true
+	}
 
-			loadVar := func(name string) (string, bool) {
-				if v, ok := loadVarFromMap(cmd.Internal.Var, name); ok {
-					return v, true
-				}
+	if v, ok := loadVarFromMap(i.MutVar, name); ok {
+		return v, true
+	}
 
-				if v, ok := loadVarFromMap(cmd.Internal.MutVar, name); ok {
-					return v, true
-				}
+	if v, ok := loadVarFromMap(i.GlobalVar, name); ok {
+		return v, true
+	}
 
-				if v, ok := loadVarFromMap(cmd.Internal.GlobalVar, name); ok {
-					return v, true
-				}
+	if v, ok := loadVarFromMap(i.GlobalMutVar, name); ok {
+		return v, true
+	}
 
-				if v, ok := loadVarFromMap(cmd.Internal.GlobalMutVar, name); ok {
-					return v, true
-				}
+	return "", false
+}
+
+// rangeVars calls f for every visible variable. Local variables shadow
+// global ones of the same name.
+func (i Internal) rangeVars(f func(name, value string)) {
+	i.rangeVarValues(func(name string, value interface{}) {
+		v, _ := varString(value)
+		f(name, v)
+	})
+}
+
+// rangeVarValues is like rangeVars, but passes the values as they are stored,
+// which are strings or jsonVars.
+func (i Internal) rangeVarValues(f func(name string, value interface{})) {
+	seen := map[string]bool{}
+	for _, m := range []*sync.Map{i.Var, i.MutVar, i.GlobalVar, i.GlobalMutVar} {
+		m.Range(func(key, value interface{}) bool {
+			k, ok := key.(string)
+			if !ok || seen[k] {
+				return true
+			}
 
-				return "", false
+			if _, ok := varString(value); !ok {
+				return true
 			}
 
-			f := flag.NewFlagSet("var", flag.ContinueOnError)
-			isMut := f.Bool("mut", false, "")
-			isRef := f.Bool("ref", false, "")
-			isCh := f.Bool("ch", false, "")
-			isDel := f.Bool("del", false, "")
-			isShow := f.Bool("show", false, "")
-			isGlobal := f.Bool("global", false, "")
-			isCheck := f.Bool("check", false, "")
+			seen[k] = true
+			f(k, value)
+			return true
+		})
+	}
+}
 
-			if err := f.Parse(argv); err != nil {
+func (cmd Command) setInternalVarFamily() {
+	cmd.Internal.SetInternalCmd("l-var", InternalCmd{
+		Synopsis: "l-var [--mut] [--global] <name> <value> | --ref <name> | --ch <name> <value> | --del <name> | --show | --check <name>",
+		Desc: "Defines a variable, whose value is printed with l-var --ref name.\n" +
+			"A variable is immutable unless it is defined with --mut, and is local to the function unless it is defined with --global.",
+		Flags: []Flag{
+			{Name: "mut", Value: false, Usage: "define a mutable variable"},
+			{Name: "ref", Value: false, Usage: "print the value of the variable"},
+			{Name: "ch", Value: false, Usage: "change the value of a mutable variable"},
+			{Name: "del", Value: false, Usage: "remove the variable"},
+			{Name: "show", Value: false, Usage: "list the variables"},
+			{Name: "global", Value: false, Usage: "define or remove a global variable"},
+			{Name: "check", Value: false, Usage: "print whether the variable is defined"},
+		},
+		Examples: []string{
+			"l-var name world; l-echo hello (l-var --ref name)",
+			"l-var --mut count 0; l-var --ch count 1",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-var", argv)
+			if err != nil {
 				return err
 			}
+			isMut := flagBool(f, "mut")
+			isRef := flagBool(f, "ref")
+			isCh := flagBool(f, "ch")
+			isDel := flagBool(f, "del")
+			isShow := flagBool(f, "show")
+			isGlobal := flagBool(f, "global")
+			isCheck := flagBool(f, "check")
 
-			if *isCheck {
+			if isCheck {
 				if err := checkArgv(f.Args(), 1); err != nil {
 					return err
 				}
-				_, ok := loadVar(f.Arg(0))
+				_, ok := cmd.Internal.loadVar(f.Arg(0))
 				fmt.Fprintln(cmd.Stdout, ok)
 				return nil
 			}
 
-			if *isMut && (*isRef || *isCh || *isDel || *isShow) {
+			if isMut && (isRef || isCh || isDel || isShow) {
 				return fmt.Errorf("cannot set --mut and others")
 			}
 
-			if *isRef && (*isCh || *isDel || *isShow) {
+			if isRef && (isCh || isDel || isShow) {
 				return fmt.Errorf("cannot set --ref and others")
 			}
 
-			if *isCh && (*isDel || *isShow) {
+			if isCh && (isDel || isShow) {
 				return fmt.Errorf("cannot set --ch and others")
 			}
 
-			if *isDel && *isShow {
+			if isDel && isShow {
 				return fmt.Errorf("cannot set both --del and --show")
 			}
 
 			var varMap = cmd.Internal.Var
-			if *isGlobal {
+			if isGlobal {
 				varMap = cmd.Internal.GlobalVar
 			}
 
 			var mutVarMap = cmd.Internal.MutVar
-			if *isGlobal {
+			if isGlobal {
 				mutVarMap = cmd.Internal.GlobalMutVar
 			}
 
 			switch {
-			case !*isMut && !*isRef && !*isCh && !*isDel && !*isShow:
+			case !isMut && !isRef && !isCh && !isDel && !isShow:
 				if f.Arg(0) == "" {
 					return fmt.Errorf("key is blank")
 				}
@@ -433,14 +628,14 @@ func (cmd Command) setInternalVarFamily() {
 					return fmt.Errorf("value is blank")
 				}
 
-				if _, ok := loadVar(f.Arg(0)); ok {
+				if _, ok := cmd.Internal.loadVar(f.Arg(0)); ok {
 					return fmt.Errorf("variable is already exists: %v", f.Arg(0))
 				}
 
 				storeVarToMap(varMap, f.Arg(0), f.Arg(1))
 				return nil
 
-			case *isMut && !*isRef && !*isCh && !*isDel && !*isShow:
+			case isMut && !isRef && !isCh && !isDel && !isShow:
 				if f.Arg(0) == "" {
 					return fmt.Errorf("key is blank")
 				}
@@ -449,7 +644,7 @@ func (cmd Command) setInternalVarFamily() {
 					return fmt.Errorf("value is blank")
 				}
 
-				if _, ok := loadVar(f.Arg(0)); ok {
+				if _, ok := cmd.Internal.loadVar(f.Arg(0)); ok {
 					return fmt.Errorf("variable is already exists: %v", f.Arg(0))
 				}
 
@@ -457,24 +652,24 @@ func (cmd Command) setInternalVarFamily() {
 
 				return nil
 
-			case !*isMut && *isRef && !*isCh && !*isDel && !*isShow:
+			case !isMut && isRef && !isCh && !isDel && !isShow:
 				if f.Arg(0) == "" {
 					return fmt.Errorf("key is blank")
 				}
 
-				v, ok := loadVar(f.Arg(0))
+				v, ok := cmd.Internal.loadVar(f.Arg(0))
 				if !ok {
 					return fmt.Errorf("variable is not defined: %v", f.Arg(0))
 				}
 				fmt.Fprintln(cmd.Stdout, v)
 				return nil
 
-			case !*isMut && !*isRef && *isCh && !*isDel && !*isShow:
+			case !isMut && !isRef && isCh && !isDel && !isShow:
 				if f.Arg(0) == "" {
 					return fmt.Errorf("key is blank")
 				}
 
-				if _, ok := loadVar(f.Arg(0)); !ok {
+				if _, ok := cmd.Internal.loadVar(f.Arg(0)); !ok {
 					return fmt.Errorf("variable is not defined: %v", f.Arg(0))
 				}
 
@@ -490,7 +685,7 @@ func (cmd Command) setInternalVarFamily() {
 
 				return nil
 
-			case !*isMut && !*isRef && !*isCh && *isDel && !*isShow:
+			case !isMut && !isRef && !isCh && isDel && !isShow:
 				if f.Arg(0) == "" {
 					return fmt.Errorf("key is blank")
 				}
@@ -499,7 +694,7 @@ func (cmd Command) setInternalVarFamily() {
 				cmd.Internal.MutVar.Delete(f.Arg(0))
 				return nil
 
-			case !*isMut && !*isRef && !*isCh && !*isDel && *isShow:
+			case !isMut && !isRef && !isCh && !isDel && isShow:
 				sprint := func(m *sync.Map, title string) string {
 					res := title
 					s := []string{}
@@ -509,7 +704,7 @@ func (cmd Command) setInternalVarFamily() {
 							return false
 						}
 
-						v, ok := value.(string)
+						v, ok := varString(value)
 						if !ok {
 							return false
 						}
@@ -535,13 +730,20 @@ func (cmd Command) setInternalVarFamily() {
 
 func (cmd Command) setInternalEvalFamily() {
 	cmd.Internal.Cmds.Store("l-eval", InternalCmd{
-		Usage: "l-eval",
+		Synopsis: "l-eval {block} [args...]",
+		Desc:     "Runs block in a new scope, with args as the arguments which l-arg reads.",
+		Examples: []string{"l-eval {l-echo (l-arg 0)} hello"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 1); err != nil {
 				return err
 			}
 
+			// Tasks started in the scope end with it.
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
 			c := cmd
+			c.scope = ctx
 			c.Internal.Var = new(sync.Map)
 			c.Internal.MutVar = new(sync.Map)
 			c.Internal.Args = new(sync.Map)
@@ -556,6 +758,8 @@ func (cmd Command) setInternalEvalFamily() {
 				return err
 			case funcReturnErr:
 				break
+			default:
+				return err
 			}
 
 			cmd.Internal.Return.Range(func(key, value interface{}) bool {
@@ -583,28 +787,61 @@ func (cmd Command) setInternalEvalFamily() {
 		},
 	})
 
+	cmd.Internal.Cmds.Store("l-source", InternalCmd{
+		Synopsis: "l-source <file> [args...]",
+		Desc:     "Runs the commands in file in the current scope, with args as the arguments which l-arg reads.",
+		Examples: []string{"l-source ~/.config/lalash/rc"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			c := cmd
+			if len(argv) > 1 {
+				c.Internal.Args = new(sync.Map)
+				for i, v := range argv[1:] {
+					c.Internal.Args.Store(i, v)
+				}
+			}
+
+			return sourceFile(ctx, c, argv[0])
+		},
+	})
+
 	cmd.Internal.Cmds.Store("l-pipe", InternalCmd{
-		Usage: "l-pipe",
+		Synopsis: "l-pipe [-p pairs | --in file | --out file] {block} [{block}]",
+		Desc: "Connects the output of the first block to the input of the second one, or a block to a file.\n" +
+			"A pair \"in:out\" connects the file descriptor in of the first block to out of the second one, where 0 is the standard input and 3 or more are passed to the commands which take --fd. The pairs are separated by commas.",
+		Flags: []Flag{
+			{Name: "p", Value: "", Arg: "pairs", Usage: "connect the file descriptors of the pairs, \"1:0\" if none are given"},
+			{Name: "in", Value: "", Arg: "file", Usage: "read the standard input of the block from file"},
+			{Name: "out", Value: "", Arg: "file", Usage: "write the standard output of the block to file"},
+		},
+		Examples: []string{
+			"l-pipe {l-echo abc} l-cat",
+			"l-pipe -p 2 {l-echo --fd 2 abc} l-cat",
+			"l-pipe --out out.txt {l-echo abc}",
+		},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			f := flag.NewFlagSet("pipe", flag.ContinueOnError)
-			p := f.String("p", "", "")
-			in := f.String("in", "", "")
-			out := f.String("out", "", "")
-			if err := f.Parse(argv); err != nil {
+			f, err := cmd.parseFlags("l-pipe", argv)
+			if err != nil {
 				return err
 			}
+			p := flagString(f, "p")
+			in := flagString(f, "in")
+			out := flagString(f, "out")
 
-			if *in != "" && *out != "" {
+			if in != "" && out != "" {
 				return fmt.Errorf("can not set both --in and --out")
 			}
 
-			if (*in != "" || *out != "") && *p != "" {
+			if (in != "" || out != "") && p != "" {
 				return fmt.Errorf("can not set both -p and --in / --out")
 			}
 
-			if *in != "" {
+			if in != "" {
 				cmd1 := cmd
-				i, err := filepath.Abs(*in)
+				i, err := cmd.absPath(in)
 				if err != nil {
 					return err
 				}
@@ -622,9 +859,9 @@ func (cmd Command) setInternalEvalFamily() {
 				return nil
 			}
 
-			if *out != "" {
+			if out != "" {
 				cmd1 := cmd
-				o, err := filepath.Abs(*out)
+				o, err := cmd.absPath(out)
 				if err != nil {
 					return err
 				}
@@ -642,8 +879,8 @@ func (cmd Command) setInternalEvalFamily() {
 				return nil
 			}
 
-			if *p == "" {
-				*p = "1:0"
+			if p == "" {
+				p = "1:0"
 			}
 
 			type pair struct {
@@ -684,7 +921,7 @@ func (cmd Command) setInternalEvalFamily() {
 				}
 
 				return res, nil
-			}(*p)
+			}(p)
 			if err != nil {
 				return err
 			}
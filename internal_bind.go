@@ -0,0 +1,147 @@
+package lalash
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/w-haibara/lalash/editor"
+)
+
+// bindBlock returns a binding which calls block with the line and the
+// cursor. If replace is set, the output of block replaces the line.
+func (cmd Command) bindBlock(block string, replace bool) editor.Binding {
+	desc := "{" + block + "}"
+	if replace {
+		desc = "--replace " + desc
+	}
+
+	return editor.Binding{
+		Desc: desc,
+		Func: func(line string, pos int) (string, int) {
+			ctx := context.Background()
+			if cmd.signals != nil {
+				c, cancel := cmd.signals.context(ctx)
+				defer cancel()
+				ctx = c
+			}
+
+			if !replace {
+				if err := callFunc(ctx, cmd, block, line, strconv.Itoa(pos)); err != nil {
+					fmt.Fprintln(cmd.Stderr, err.Error())
+				}
+				return line, pos
+			}
+
+			out, err := callFuncOutput(ctx, cmd, block, line, strconv.Itoa(pos))
+			if err != nil {
+				fmt.Fprintln(cmd.Stderr, err.Error())
+				return line, pos
+			}
+
+			out = strings.TrimSuffix(out, "\n")
+			return out, len([]rune(out))
+		},
+	}
+}
+
+func (cmd Command) setInternalBindFamily() {
+	cmd.Internal.Cmds.Store("l-bind", InternalCmd{
+		Synopsis: "l-bind [-k keymap] [--replace] <keys> <action|{block}> | [-k keymap] --del <keys> | [-k keymap] --list | --actions | --mode <vi|emacs>",
+		Desc: "Binds a key sequence of the line editor to an action or a block.\n" +
+			`Keys are names such as "ctrl-x" or "alt-left" separated by spaces. The block receives the line and the cursor position, and with --replace, its output replaces the line.`,
+		Flags: []Flag{
+			{Name: "k", Value: "", Arg: "keymap", Usage: "the keymap: emacs, vi-insert or vi-command, or the one in use if none is given"},
+			{Name: "replace", Value: false, Usage: "replace the line with the output of the block"},
+			{Name: "del", Value: false, Usage: "remove the binding of keys"},
+			{Name: "list", Value: false, Usage: "list the bindings of the keymap"},
+			{Name: "actions", Value: false, Usage: "list the actions"},
+			{Name: "mode", Value: "", Arg: "mode", Usage: "select the editing mode, vi or emacs"},
+		},
+		Examples: []string{
+			"l-bind --mode vi",
+			"l-bind ctrl-g beginning-of-line",
+			`l-bind --replace "ctrl-x ctrl-u" {s-to-upper (l-arg 0)}`,
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-bind", argv)
+			if err != nil {
+				return err
+			}
+			km := flagString(f, "k")
+			replace := flagBool(f, "replace")
+			del := flagBool(f, "del")
+			list := flagBool(f, "list")
+			listActions := flagBool(f, "actions")
+			mode := flagString(f, "mode")
+
+			if listActions {
+				for _, v := range editor.Actions() {
+					fmt.Fprintln(cmd.Stdout, v)
+				}
+				return nil
+			}
+
+			if cmd.line == nil {
+				return fmt.Errorf("no line editor")
+			}
+
+			if mode != "" {
+				return cmd.line.SetMode(mode)
+			}
+
+			// Lines begin in the keymap which is in use between them.
+			if km == "" {
+				km = cmd.line.Keymap()
+			}
+
+			switch {
+			case list:
+				bindings, err := cmd.line.Bindings(km)
+				if err != nil {
+					return err
+				}
+
+				keys := []string{}
+				for k := range bindings {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+
+				for _, k := range keys {
+					fmt.Fprintln(cmd.Stdout, k, ":", bindings[k])
+				}
+
+				return nil
+
+			case del:
+				if err := checkArgv(f.Args(), 1); err != nil {
+					return err
+				}
+				return cmd.line.Unbind(km, f.Arg(0))
+			}
+
+			if err := checkArgv(f.Args(), 2); err != nil {
+				return err
+			}
+
+			b := editor.Binding{Action: f.Arg(1)}
+			if replace || !isAction(f.Arg(1)) {
+				b = cmd.bindBlock(f.Arg(1), replace)
+			}
+
+			return cmd.line.Bind(km, f.Arg(0), b)
+		},
+	})
+}
+
+func isAction(name string) bool {
+	for _, v := range editor.Actions() {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,694 @@
+package lalash
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type csvOptions struct {
+	sep        string
+	tsv        bool
+	noHeader   bool
+	lazyQuotes bool
+	quote      string
+	crlf       bool
+}
+
+// csvFlags are the flags of all the commands of the family.
+var csvFlags = []Flag{
+	{Name: "sep", Value: ",", Arg: "char", Usage: `separate the fields with char, where "\t" is a tab`},
+	{Name: "tsv", Value: false, Usage: "separate the fields with tabs"},
+	{Name: "no-header", Value: false, Usage: "read the first record as data, not as the header"},
+	{Name: "lazy-quotes", Value: false, Usage: "allow quotes in unquoted fields and unescaped quotes in quoted fields"},
+	{Name: "quote", Value: "auto", Arg: "mode", Usage: "quote the fields written only when needed (auto), always (all) or never (none)"},
+	{Name: "crlf", Value: false, Usage: "end the records written with CRLF"},
+}
+
+func csvOpts(f *flag.FlagSet) csvOptions {
+	return csvOptions{
+		sep:        flagString(f, "sep"),
+		tsv:        flagBool(f, "tsv"),
+		noHeader:   flagBool(f, "no-header"),
+		lazyQuotes: flagBool(f, "lazy-quotes"),
+		quote:      flagString(f, "quote"),
+		crlf:       flagBool(f, "crlf"),
+	}
+}
+
+func (o csvOptions) comma() (rune, error) {
+	if o.tsv {
+		return '\t', nil
+	}
+
+	sep := o.sep
+	if sep == `\t` {
+		return '\t', nil
+	}
+
+	r, n := utf8.DecodeRuneInString(sep)
+	if n == 0 || n != len(sep) {
+		return 0, fmt.Errorf("separator must be a single character: %q", sep)
+	}
+
+	return r, nil
+}
+
+func (o csvOptions) reader(r io.Reader) (*csv.Reader, error) {
+	comma, err := o.comma()
+	if err != nil {
+		return nil, err
+	}
+
+	res := csv.NewReader(r)
+	res.Comma = comma
+	res.LazyQuotes = o.lazyQuotes
+	res.FieldsPerRecord = -1
+
+	return res, nil
+}
+
+// csvWriter writes records quoted according to --quote: "auto" quotes fields
+// only when needed, "all" quotes every field and "none" never quotes.
+type csvWriter struct {
+	w     io.Writer
+	csv   *csv.Writer
+	comma rune
+	quote string
+	crlf  bool
+}
+
+func (o csvOptions) writer(w io.Writer) (*csvWriter, error) {
+	comma, err := o.comma()
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.quote {
+	case "auto", "all", "none":
+	default:
+		return nil, fmt.Errorf("invalid quote mode: %v", o.quote)
+	}
+
+	c := csv.NewWriter(w)
+	c.Comma = comma
+	c.UseCRLF = o.crlf
+
+	return &csvWriter{
+		w:     w,
+		csv:   c,
+		comma: comma,
+		quote: o.quote,
+		crlf:  o.crlf,
+	}, nil
+}
+
+func (w *csvWriter) Write(record []string) error {
+	if w.quote == "auto" {
+		if err := w.csv.Write(record); err != nil {
+			return err
+		}
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+
+	fields := make([]string, len(record))
+	for i, v := range record {
+		if w.quote == "all" {
+			v = `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+		}
+		fields[i] = v
+	}
+
+	eol := "\n"
+	if w.crlf {
+		eol = "\r\n"
+	}
+
+	_, err := io.WriteString(w.w, strings.Join(fields, string(w.comma))+eol)
+	return err
+}
+
+// csvInput opens the file given as argv[n], or returns stdin when the
+// argument is omitted.
+func csvInput(cmd Command, argv []string, n int) (io.Reader, func() error, error) {
+	if len(argv) <= n {
+		return cmd.Stdin, func() error { return nil }, nil
+	}
+
+	name, err := cmd.absPath(argv[n])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, f.Close, nil
+}
+
+// csvColumns resolves a comma separated list of column names or 0-based
+// indexes.
+func csvColumns(spec string, header []string) ([]int, error) {
+	res := []int{}
+	for _, v := range strings.Split(spec, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		found := false
+		for i, h := range header {
+			if h == v {
+				res = append(res, i)
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("column not found: %v", v)
+		}
+		res = append(res, i)
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no columns selected")
+	}
+
+	return res, nil
+}
+
+func csvField(record []string, i int) string {
+	if i < len(record) {
+		return record[i]
+	}
+	return ""
+}
+
+// csvEach reads the header, if any, and calls f for every following record.
+// header is nil when --no-header is set.
+func csvEach(ctx context.Context, o csvOptions, r io.Reader, onHeader func(header []string) error, f func(record []string) error) error {
+	c, err := o.reader(r)
+	if err != nil {
+		return err
+	}
+
+	if o.noHeader {
+		if err := onHeader(nil); err != nil {
+			return err
+		}
+	} else {
+		header, err := c.Read()
+		if err == io.EOF {
+			return onHeader(nil)
+		}
+		if err != nil {
+			return err
+		}
+		if err := onHeader(header); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		record, err := c.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := f(record); err != nil {
+			return err
+		}
+	}
+}
+
+func jsonObjectLine(keys, values []string) (string, error) {
+	var b bytes.Buffer
+	b.WriteString("{")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+
+		k, err := encodeJSON(k)
+		if err != nil {
+			return "", err
+		}
+		v, err := encodeJSON(csvField(values, i))
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(strings.TrimSuffix(k, "\n") + ":" + strings.TrimSuffix(v, "\n"))
+	}
+	b.WriteString("}")
+	return b.String(), nil
+}
+
+func csvValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	case json.Number, bool:
+		return fmt.Sprint(v), nil
+	}
+
+	s, err := encodeJSON(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(s, "\n"), nil
+}
+
+func (cmd Command) setInternalCSVFamily() {
+	cmd.Internal.Cmds.Store("csv-header", InternalCmd{
+		Synopsis: "csv-header [flags] [file]",
+		Desc: "Prints the fields of the header of a CSV, one on each line.\n" +
+			"The CSV is read from file, or from the standard input if no file is given.",
+		Flags:    csvFlags,
+		Examples: []string{"csv-header users.csv"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("csv-header", argv)
+			if err != nil {
+				return err
+			}
+			o := csvOpts(f)
+
+			in, closeIn, err := csvInput(cmd, f.Args(), 0)
+			if err != nil {
+				return err
+			}
+			defer closeIn()
+
+			c, err := o.reader(in)
+			if err != nil {
+				return err
+			}
+
+			header, err := c.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, v := range header {
+				fmt.Fprintln(cmd.Stdout, v)
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("csv-count", InternalCmd{
+		Synopsis: "csv-count [flags] [file]",
+		Desc:     "Prints the number of the records of a CSV, without the header.",
+		Flags:    csvFlags,
+		Examples: []string{"csv-count users.csv"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("csv-count", argv)
+			if err != nil {
+				return err
+			}
+			o := csvOpts(f)
+
+			in, closeIn, err := csvInput(cmd, f.Args(), 0)
+			if err != nil {
+				return err
+			}
+			defer closeIn()
+
+			n := 0
+			if err := csvEach(ctx, o, in, func(header []string) error {
+				return nil
+			}, func(record []string) error {
+				n++
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, n)
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("csv-select", InternalCmd{
+		Synopsis: "csv-select [flags] <columns> [file]",
+		Desc: "Writes the columns of a CSV.\n" +
+			"The columns are names of the header or numbers from 0, separated by commas.",
+		Flags: csvFlags,
+		Examples: []string{
+			"csv-select name,age users.csv",
+			"csv-select --no-header 0,2 data.csv",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("csv-select", argv)
+			if err != nil {
+				return err
+			}
+			o := csvOpts(f)
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			in, closeIn, err := csvInput(cmd, f.Args(), 1)
+			if err != nil {
+				return err
+			}
+			defer closeIn()
+
+			w, err := o.writer(cmd.Stdout)
+			if err != nil {
+				return err
+			}
+
+			var cols []int
+			pick := func(record []string) []string {
+				res := make([]string, len(cols))
+				for i, c := range cols {
+					res[i] = csvField(record, c)
+				}
+				return res
+			}
+
+			return csvEach(ctx, o, in, func(header []string) error {
+				cols, err = csvColumns(f.Arg(0), header)
+				if err != nil {
+					return err
+				}
+				if header == nil {
+					return nil
+				}
+				return w.Write(pick(header))
+			}, func(record []string) error {
+				return w.Write(pick(record))
+			})
+		},
+	})
+
+	cmd.Internal.Cmds.Store("csv-filter", InternalCmd{
+		Synopsis: "csv-filter [flags] {block} [file]",
+		Desc: "Writes the records of a CSV for which block prints \"true\".\n" +
+			"The block receives the fields of each record as its arguments. The header is written as it is.",
+		Flags:    csvFlags,
+		Examples: []string{"csv-filter {s-equal-fold (l-arg 1) tokyo} users.csv"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("csv-filter", argv)
+			if err != nil {
+				return err
+			}
+			o := csvOpts(f)
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			in, closeIn, err := csvInput(cmd, f.Args(), 1)
+			if err != nil {
+				return err
+			}
+			defer closeIn()
+
+			w, err := o.writer(cmd.Stdout)
+			if err != nil {
+				return err
+			}
+
+			return csvEach(ctx, o, in, func(header []string) error {
+				if header == nil {
+					return nil
+				}
+				return w.Write(header)
+			}, func(record []string) error {
+				res, err := callFuncOutput(ctx, cmd, f.Arg(0), record...)
+				if err != nil {
+					return err
+				}
+				if strings.TrimSpace(res) != "true" {
+					return nil
+				}
+				return w.Write(record)
+			})
+		},
+	})
+
+	cmd.Internal.Cmds.Store("csv-sort", InternalCmd{
+		Synopsis: "csv-sort [-k columns] [-n] [-r] [flags] [file]",
+		Desc: "Sorts the records of a CSV by the columns.\n" +
+			"The columns are names of the header or numbers from 0, separated by commas. The header stays first.",
+		Flags: append([]Flag{
+			{Name: "k", Value: "0", Arg: "columns", Usage: "sort by the columns"},
+			{Name: "n", Value: false, Usage: "compare the fields as numbers"},
+			{Name: "r", Value: false, Usage: "sort in reverse order"},
+		}, csvFlags...),
+		Examples: []string{
+			"csv-sort -k age -n users.csv",
+			"csv-sort -k name,age -r users.csv",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("csv-sort", argv)
+			if err != nil {
+				return err
+			}
+			key := flagString(f, "k")
+			isNum := flagBool(f, "n")
+			isRev := flagBool(f, "r")
+			o := csvOpts(f)
+
+			in, closeIn, err := csvInput(cmd, f.Args(), 0)
+			if err != nil {
+				return err
+			}
+			defer closeIn()
+
+			w, err := o.writer(cmd.Stdout)
+			if err != nil {
+				return err
+			}
+
+			var cols []int
+			records := [][]string{}
+			if err := csvEach(ctx, o, in, func(header []string) error {
+				cols, err = csvColumns(key, header)
+				if err != nil {
+					return err
+				}
+				if header == nil {
+					return nil
+				}
+				return w.Write(header)
+			}, func(record []string) error {
+				records = append(records, record)
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			less := func(a, b []string) bool {
+				for _, c := range cols {
+					x, y := csvField(a, c), csvField(b, c)
+					if x == y {
+						continue
+					}
+					if isNum {
+						fx, errx := strconv.ParseFloat(x, 64)
+						fy, erry := strconv.ParseFloat(y, 64)
+						if errx == nil && erry == nil {
+							return fx < fy
+						}
+					}
+					return x < y
+				}
+				return false
+			}
+
+			sort.SliceStable(records, func(i, j int) bool {
+				if isRev {
+					return less(records[j], records[i])
+				}
+				return less(records[i], records[j])
+			})
+
+			for _, v := range records {
+				if err := w.Write(v); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("csv-to-json", InternalCmd{
+		Synopsis: "csv-to-json [flags] [file]",
+		Desc: "Converts a CSV to a JSON array.\n" +
+			"Each record becomes an object keyed by the header, or an array of the fields with --no-header.",
+		Flags:    csvFlags,
+		Examples: []string{"j-pretty (csv-to-json users.csv)"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("csv-to-json", argv)
+			if err != nil {
+				return err
+			}
+			o := csvOpts(f)
+
+			in, closeIn, err := csvInput(cmd, f.Args(), 0)
+			if err != nil {
+				return err
+			}
+			defer closeIn()
+
+			var header []string
+			first := true
+			fmt.Fprint(cmd.Stdout, "[")
+			if err := csvEach(ctx, o, in, func(h []string) error {
+				header = h
+				return nil
+			}, func(record []string) error {
+				var s string
+				var err error
+				if header == nil {
+					s, err = encodeJSON(record)
+					s = strings.TrimSuffix(s, "\n")
+				} else {
+					s, err = jsonObjectLine(header, record)
+				}
+				if err != nil {
+					return err
+				}
+
+				if !first {
+					fmt.Fprint(cmd.Stdout, ",")
+				}
+				first = false
+				fmt.Fprint(cmd.Stdout, s)
+
+				return nil
+			}); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.Stdout, "]")
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("csv-from-json", InternalCmd{
+		Synopsis: "csv-from-json [--cols names] [flags] [file]",
+		Desc: "Converts a JSON array of objects or arrays to a CSV.\n" +
+			"The keys of the first object are the columns, in sorted order, unless --cols is given.",
+		Flags: append([]Flag{
+			{Name: "cols", Value: "", Arg: "names", Usage: "the keys of the columns, separated by commas"},
+		}, csvFlags...),
+		Examples: []string{"csv-from-json --cols name,age users.json"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("csv-from-json", argv)
+			if err != nil {
+				return err
+			}
+			colsFlag := flagString(f, "cols")
+			o := csvOpts(f)
+
+			in, closeIn, err := csvInput(cmd, f.Args(), 0)
+			if err != nil {
+				return err
+			}
+			defer closeIn()
+
+			w, err := o.writer(cmd.Stdout)
+			if err != nil {
+				return err
+			}
+
+			d := json.NewDecoder(in)
+			d.UseNumber()
+
+			if t, err := d.Token(); err != nil || t != json.Delim('[') {
+				return fmt.Errorf("invalid JSON: array required")
+			}
+
+			var cols []string
+			if colsFlag != "" {
+				cols = strings.Split(colsFlag, ",")
+			}
+
+			for i := 0; d.More(); i++ {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				var v interface{}
+				if err := d.Decode(&v); err != nil {
+					return fmt.Errorf("invalid JSON: [%d]: %v", i, err)
+				}
+
+				var record []string
+				switch v := v.(type) {
+				case map[string]interface{}:
+					if cols == nil {
+						cols = sortedKeys(v)
+					}
+					if i == 0 && !o.noHeader {
+						if err := w.Write(cols); err != nil {
+							return err
+						}
+					}
+					for _, k := range cols {
+						s, err := csvValue(v[k])
+						if err != nil {
+							return err
+						}
+						record = append(record, s)
+					}
+
+				case []interface{}:
+					for _, c := range v {
+						s, err := csvValue(c)
+						if err != nil {
+							return err
+						}
+						record = append(record, s)
+					}
+
+				default:
+					return fmt.Errorf("[%d]: cannot convert %v to a row", i, jsonType(v))
+				}
+
+				if err := w.Write(record); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+}
@@ -0,0 +1,218 @@
+package lalash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// workDir is the working directory of a shell. It is kept apart from the one
+// of the process so that shells and tasks in a process do not share it.
+type workDir struct {
+	mu    sync.Mutex
+	pwd   string
+	old   string
+	stack []string
+}
+
+func newWorkDir() *workDir {
+	pwd, _ := os.Getwd()
+	return &workDir{pwd: pwd}
+}
+
+func (w *workDir) get() string {
+	if w == nil {
+		return ""
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.pwd
+}
+
+// clone returns a copy of w for a task, which changes directories on its own.
+func (w *workDir) clone() *workDir {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return &workDir{
+		pwd:   w.pwd,
+		old:   w.old,
+		stack: append([]string{}, w.stack...),
+	}
+}
+
+// chdir changes the working directory to dir, which must be absolute.
+func (w *workDir) chdir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory: %v", dir)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.old, w.pwd = w.pwd, dir
+
+	return nil
+}
+
+// cdTarget resolves the argument of l-cd. A relative name which does not
+// start with "." is searched in the directories of CDPATH first; found is set
+// if it is found there.
+func (cmd Command) cdTarget(name string) (dir string, found bool, err error) {
+	switch {
+	case name == "":
+		home, err := os.UserHomeDir()
+		return home, false, err
+
+	case name == "-":
+		cmd.wd.mu.Lock()
+		defer cmd.wd.mu.Unlock()
+
+		if cmd.wd.old == "" {
+			return "", false, fmt.Errorf("OLDPWD not set")
+		}
+		return cmd.wd.old, true, nil
+	}
+
+	if !filepath.IsAbs(name) && !strings.HasPrefix(name, ".") {
+		cdpath, ok := cmd.Internal.loadVar("CDPATH")
+		if !ok {
+			cdpath = os.Getenv("CDPATH")
+		}
+
+		for _, v := range filepath.SplitList(cdpath) {
+			if v == "" {
+				continue
+			}
+
+			d, err := cmd.absPath(filepath.Join(v, name))
+			if err != nil {
+				return "", false, err
+			}
+			if info, err := os.Stat(d); err == nil && info.IsDir() {
+				return d, true, nil
+			}
+		}
+	}
+
+	d, err := cmd.absPath(name)
+	return d, false, err
+}
+
+func (cmd Command) setInternalDirFamily() {
+	cmd.Internal.Cmds.Store("l-pwd", InternalCmd{
+		Synopsis: "l-pwd",
+		Desc:     "Prints the working directory.",
+		Examples: []string{"l-pwd"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			dir, err := cmd.absPath(".")
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, dir)
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-pushd", InternalCmd{
+		Synopsis: "l-pushd [path]",
+		Desc: "Changes the working directory to path and pushes the previous one onto the directory stack.\n" +
+			"Without path, it swaps the working directory and the top of the stack.",
+		Examples: []string{"l-pushd /tmp; l-popd"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if len(argv) == 0 {
+				cmd.wd.mu.Lock()
+				if len(cmd.wd.stack) == 0 {
+					cmd.wd.mu.Unlock()
+					return fmt.Errorf("no other directory")
+				}
+				top := cmd.wd.stack[0]
+				cmd.wd.mu.Unlock()
+
+				pwd := cmd.wd.get()
+				if err := cmd.wd.chdir(top); err != nil {
+					return err
+				}
+
+				cmd.wd.mu.Lock()
+				cmd.wd.stack[0] = pwd
+				cmd.wd.mu.Unlock()
+
+				return nil
+			}
+
+			dir, _, err := cmd.cdTarget(argv[0])
+			if err != nil {
+				return err
+			}
+
+			pwd := cmd.wd.get()
+			if err := cmd.wd.chdir(dir); err != nil {
+				return err
+			}
+
+			cmd.wd.mu.Lock()
+			cmd.wd.stack = append([]string{pwd}, cmd.wd.stack...)
+			cmd.wd.mu.Unlock()
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-popd", InternalCmd{
+		Synopsis: "l-popd",
+		Desc:     "Pops a directory from the directory stack and changes the working directory to it.",
+		Examples: []string{"l-pushd /tmp; l-popd"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			cmd.wd.mu.Lock()
+			if len(cmd.wd.stack) == 0 {
+				cmd.wd.mu.Unlock()
+				return fmt.Errorf("directory stack empty")
+			}
+			top := cmd.wd.stack[0]
+			cmd.wd.mu.Unlock()
+
+			if err := cmd.wd.chdir(top); err != nil {
+				return err
+			}
+
+			cmd.wd.mu.Lock()
+			cmd.wd.stack = cmd.wd.stack[1:]
+			cmd.wd.mu.Unlock()
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-dirs", InternalCmd{
+		Synopsis: "l-dirs",
+		Desc:     "Prints the working directory followed by the directory stack, one on each line.",
+		Examples: []string{"l-dirs"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			cmd.wd.mu.Lock()
+			dirs := append([]string{cmd.wd.pwd}, cmd.wd.stack...)
+			cmd.wd.mu.Unlock()
+
+			for _, v := range dirs {
+				fmt.Fprintln(cmd.Stdout, v)
+			}
+
+			return nil
+		},
+	})
+}
@@ -0,0 +1,694 @@
+package lalash
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// relPath returns abs relative to the working directory when it is inside
+// of it, so that outputs look like the arguments given by the user.
+func (cmd Command) relPath(abs string) string {
+	wd, err := cmd.absPath(".")
+	if err != nil {
+		return abs
+	}
+
+	if !isWithin(wd, abs) {
+		return abs
+	}
+
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil {
+		return abs
+	}
+
+	return rel
+}
+
+// isWithin reports whether path is dir or inside of it.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func fileLongFormat(info fs.FileInfo, name string) string {
+	return fmt.Sprintf("%v\t%d\t%v\t%v", info.Mode(), info.Size(), info.ModTime().Format(time.RFC3339), name)
+}
+
+func copyFile(src, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+func copyTree(ctx context.Context, src, dst string, recursive bool) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return copyFile(src, dst, info.Mode())
+	}
+
+	if !recursive {
+		return fmt.Errorf("%v is a directory (not copied)", src)
+	}
+
+	if isWithin(src, dst) {
+		return fmt.Errorf("cannot copy %v into itself", src)
+	}
+
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+
+		return copyFile(path, target, info.Mode())
+	})
+}
+
+// destPath returns the path to copy or move src to. Like cp and mv, an
+// existing directory as dst means "into dst".
+func destPath(src, dst string) string {
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		return filepath.Join(dst, filepath.Base(src))
+	}
+	return dst
+}
+
+func writeFileFrom(cmd Command, name string, flag int, argv []string, noNewline bool) error {
+	file, err := os.OpenFile(name, flag, 0666)
+	if err != nil {
+		return err
+	}
+
+	if len(argv) > 0 {
+		s := strings.Join(argv, " ")
+		if !noNewline {
+			s += "\n"
+		}
+		_, err = io.WriteString(file, s)
+	} else {
+		_, err = io.Copy(file, cmd.Stdin)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (cmd Command) setInternalFileFamily() {
+	cmd.Internal.Cmds.Store("f-ls", InternalCmd{
+		Synopsis: "f-ls [-l] [-a] [paths...]",
+		Desc:     "Lists the files in the directories, or the working directory if no paths are given.",
+		Flags: []Flag{
+			{Name: "l", Value: false, Usage: "show the mode, the size and the modification time of each file"},
+			{Name: "a", Value: false, Usage: `list the files whose names begin with "." too`},
+		},
+		Examples: []string{"f-ls -l /tmp"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("f-ls", argv)
+			if err != nil {
+				return err
+			}
+			isLong := flagBool(f, "l")
+			isAll := flagBool(f, "a")
+
+			paths := f.Args()
+			if len(paths) == 0 {
+				paths = []string{"."}
+			}
+
+			for _, p := range paths {
+				name, err := cmd.absPath(p)
+				if err != nil {
+					return err
+				}
+
+				info, err := os.Stat(name)
+				if err != nil {
+					return err
+				}
+
+				if !info.IsDir() {
+					if isLong {
+						fmt.Fprintln(cmd.Stdout, fileLongFormat(info, p))
+						continue
+					}
+					fmt.Fprintln(cmd.Stdout, p)
+					continue
+				}
+
+				entries, err := os.ReadDir(name)
+				if err != nil {
+					return err
+				}
+
+				for _, e := range entries {
+					if !isAll && strings.HasPrefix(e.Name(), ".") {
+						continue
+					}
+
+					if !isLong {
+						fmt.Fprintln(cmd.Stdout, e.Name())
+						continue
+					}
+
+					info, err := e.Info()
+					if err != nil {
+						return err
+					}
+					fmt.Fprintln(cmd.Stdout, fileLongFormat(info, e.Name()))
+				}
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-stat", InternalCmd{
+		Synopsis: "f-stat <path>",
+		Desc: "Prints the name, the size, the mode and the modification time of a file.\n" +
+			"A symbolic link is not followed.",
+		Examples: []string{"f-stat go.mod"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			name, err := cmd.absPath(argv[0])
+			if err != nil {
+				return err
+			}
+
+			info, err := os.Lstat(name)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.Stdout, "name : %v\n", info.Name())
+			fmt.Fprintf(cmd.Stdout, "path : %v\n", name)
+			fmt.Fprintf(cmd.Stdout, "size : %d\n", info.Size())
+			fmt.Fprintf(cmd.Stdout, "mode : %v\n", info.Mode())
+			fmt.Fprintf(cmd.Stdout, "mtime : %v\n", info.ModTime().Format(time.RFC3339))
+			fmt.Fprintf(cmd.Stdout, "dir : %v\n", info.IsDir())
+			fmt.Fprintf(cmd.Stdout, "symlink : %v\n", info.Mode()&fs.ModeSymlink != 0)
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-exists", InternalCmd{
+		Synopsis: "f-exists [-d | -f] <path>",
+		Desc:     "Prints whether a file exists.",
+		Flags: []Flag{
+			{Name: "d", Value: false, Usage: "print whether it is a directory"},
+			{Name: "f", Value: false, Usage: "print whether it is a regular file"},
+		},
+		Examples: []string{"f-exists -d ~/.config"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("f-exists", argv)
+			if err != nil {
+				return err
+			}
+			isDir := flagBool(f, "d")
+			isFile := flagBool(f, "f")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			name, err := cmd.absPath(f.Arg(0))
+			if err != nil {
+				return err
+			}
+
+			info, err := os.Stat(name)
+			switch {
+			case err != nil:
+				fmt.Fprintln(cmd.Stdout, false)
+			case isDir:
+				fmt.Fprintln(cmd.Stdout, info.IsDir())
+			case isFile:
+				fmt.Fprintln(cmd.Stdout, info.Mode().IsRegular())
+			default:
+				fmt.Fprintln(cmd.Stdout, true)
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-mkdir", InternalCmd{
+		Synopsis: "f-mkdir [-p] <paths...>",
+		Desc:     "Creates directories.",
+		Flags: []Flag{
+			{Name: "p", Value: false, Usage: "create the parent directories too, and do not fail if a directory exists"},
+		},
+		Examples: []string{"f-mkdir -p a/b/c"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("f-mkdir", argv)
+			if err != nil {
+				return err
+			}
+			isParents := flagBool(f, "p")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			for _, v := range f.Args() {
+				name, err := cmd.absPath(v)
+				if err != nil {
+					return err
+				}
+
+				if isParents {
+					err = os.MkdirAll(name, 0777)
+				} else {
+					err = os.Mkdir(name, 0777)
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-rm", InternalCmd{
+		Synopsis: "f-rm [-r] [-f] <paths...>",
+		Desc:     "Removes files.",
+		Flags: []Flag{
+			{Name: "r", Value: false, Usage: "remove directories and their contents"},
+			{Name: "f", Value: false, Usage: "ignore the files which do not exist"},
+		},
+		Examples: []string{"f-rm -r -f build"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("f-rm", argv)
+			if err != nil {
+				return err
+			}
+			isRecursive := flagBool(f, "r")
+			isForce := flagBool(f, "f")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			for _, v := range f.Args() {
+				name, err := cmd.absPath(v)
+				if err != nil {
+					return err
+				}
+
+				if _, err := os.Lstat(name); err != nil {
+					if isForce && os.IsNotExist(err) {
+						continue
+					}
+					return err
+				}
+
+				if isRecursive {
+					err = os.RemoveAll(name)
+				} else {
+					err = os.Remove(name)
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-cp", InternalCmd{
+		Synopsis: "f-cp [-r] <src> <dst>",
+		Desc: "Copies a file.\n" +
+			"If dst is a directory, src is copied into it.",
+		Flags: []Flag{
+			{Name: "r", Value: false, Usage: "copy a directory and its contents"},
+		},
+		Examples: []string{"f-cp -r src backup"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("f-cp", argv)
+			if err != nil {
+				return err
+			}
+			isRecursive := flagBool(f, "r")
+
+			if err := checkArgv(f.Args(), 2); err != nil {
+				return err
+			}
+
+			src, err := cmd.absPath(f.Arg(0))
+			if err != nil {
+				return err
+			}
+
+			dst, err := cmd.absPath(f.Arg(1))
+			if err != nil {
+				return err
+			}
+
+			return copyTree(ctx, src, destPath(src, dst), isRecursive)
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-mv", InternalCmd{
+		Synopsis: "f-mv <src> <dst>",
+		Desc: "Moves or renames a file.\n" +
+			"If dst is a directory, src is moved into it.",
+		Examples: []string{"f-mv a.txt b.txt"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			src, err := cmd.absPath(argv[0])
+			if err != nil {
+				return err
+			}
+
+			dst, err := cmd.absPath(argv[1])
+			if err != nil {
+				return err
+			}
+
+			return os.Rename(src, destPath(src, dst))
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-touch", InternalCmd{
+		Synopsis: "f-touch <paths...>",
+		Desc:     "Updates the modification time of files, and creates the files which do not exist.",
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			now := time.Now()
+			for _, v := range argv {
+				name, err := cmd.absPath(v)
+				if err != nil {
+					return err
+				}
+
+				err = os.Chtimes(name, now, now)
+				if err == nil {
+					continue
+				}
+				if !os.IsNotExist(err) {
+					return err
+				}
+
+				file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0666)
+				if err != nil {
+					return err
+				}
+				if err := file.Close(); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-read", InternalCmd{
+		Synopsis: "f-read <paths...>",
+		Desc:     "Writes the contents of files to the standard output.",
+		Examples: []string{"f-read go.mod"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			for _, v := range argv {
+				name, err := cmd.absPath(v)
+				if err != nil {
+					return err
+				}
+
+				file, err := os.Open(name)
+				if err != nil {
+					return err
+				}
+
+				_, err = io.Copy(cmd.Stdout, file)
+				file.Close()
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-write", InternalCmd{
+		Synopsis: "f-write [-n] <path> [args...]",
+		Desc: "Writes the arguments to a file, replacing its contents.\n" +
+			"The arguments are separated by spaces and followed by a newline. Without arguments, the standard input is written.",
+		Flags: []Flag{
+			{Name: "n", Value: false, Usage: "do not write the newline"},
+		},
+		Examples: []string{
+			"f-write out.txt hello world",
+			"l-pipe {l-echo hello} {f-write out.txt}",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("f-write", argv)
+			if err != nil {
+				return err
+			}
+			noNewline := flagBool(f, "n")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			name, err := cmd.absPath(f.Arg(0))
+			if err != nil {
+				return err
+			}
+
+			return writeFileFrom(cmd, name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Args()[1:], noNewline)
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-append", InternalCmd{
+		Synopsis: "f-append [-n] <path> [args...]",
+		Desc: "Appends the arguments to a file.\n" +
+			"The arguments are separated by spaces and followed by a newline. Without arguments, the standard input is appended.",
+		Flags: []Flag{
+			{Name: "n", Value: false, Usage: "do not write the newline"},
+		},
+		Examples: []string{"f-append log.txt done"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("f-append", argv)
+			if err != nil {
+				return err
+			}
+			noNewline := flagBool(f, "n")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			name, err := cmd.absPath(f.Arg(0))
+			if err != nil {
+				return err
+			}
+
+			return writeFileFrom(cmd, name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, f.Args()[1:], noNewline)
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-glob", InternalCmd{
+		Synopsis: "f-glob <patterns...>",
+		Desc: "Prints the paths which match the patterns, in sorted order.\n" +
+			`The patterns are those of filepath.Match, such as "*.go".`,
+		Examples: []string{`f-glob "*.go"`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			for _, v := range argv {
+				pattern, err := cmd.absPath(v)
+				if err != nil {
+					return err
+				}
+
+				matches, err := filepath.Glob(pattern)
+				if err != nil {
+					return err
+				}
+				sort.Strings(matches)
+
+				for _, m := range matches {
+					if !filepath.IsAbs(v) {
+						m = cmd.relPath(m)
+					}
+					fmt.Fprintln(cmd.Stdout, m)
+				}
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-walk", InternalCmd{
+		Synopsis: "f-walk [--type f|d] [root]",
+		Desc:     "Prints the paths of the files in root and its subdirectories, or in the working directory if no root is given.",
+		Flags: []Flag{
+			{Name: "type", Value: "", Arg: "type", Usage: "print only the regular files (f) or the directories (d)"},
+		},
+		Examples: []string{"f-walk --type f src"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("f-walk", argv)
+			if err != nil {
+				return err
+			}
+			kind := flagString(f, "type")
+
+			switch kind {
+			case "", "f", "d":
+			default:
+				return fmt.Errorf("invalid type: %v", kind)
+			}
+
+			root := "."
+			if f.NArg() > 0 {
+				root = f.Arg(0)
+			}
+
+			name, err := cmd.absPath(root)
+			if err != nil {
+				return err
+			}
+
+			return filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				if (kind == "f" && d.IsDir()) || (kind == "d" && !d.IsDir()) {
+					return nil
+				}
+
+				if !filepath.IsAbs(root) {
+					path = cmd.relPath(path)
+				}
+				fmt.Fprintln(cmd.Stdout, path)
+
+				return nil
+			})
+		},
+	})
+
+	cmd.Internal.Cmds.Store("f-temp", InternalCmd{
+		Synopsis: "f-temp [-d] [--dir dir] [pattern]",
+		Desc: "Creates a temporary file and prints its path.\n" +
+			`The name of the file is made from pattern, where the last "*" is replaced by a random string.`,
+		Flags: []Flag{
+			{Name: "d", Value: false, Usage: "create a directory"},
+			{Name: "dir", Value: "", Arg: "dir", Usage: "create it in dir instead of the temporary directory of the system"},
+		},
+		Examples: []string{"l-var tmp (f-temp -d)"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("f-temp", argv)
+			if err != nil {
+				return err
+			}
+			isDir := flagBool(f, "d")
+			dir := flagString(f, "dir")
+
+			pattern := "lalash"
+			if f.NArg() > 0 {
+				pattern = f.Arg(0)
+			}
+
+			if dir != "" {
+				d, err := cmd.absPath(dir)
+				if err != nil {
+					return err
+				}
+				dir = d
+			}
+
+			if isDir {
+				name, err := os.MkdirTemp(dir, pattern)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.Stdout, name)
+				return nil
+			}
+
+			file, err := os.CreateTemp(dir, pattern)
+			if err != nil {
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.Stdout, file.Name())
+
+			return nil
+		},
+	})
+}
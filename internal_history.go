@@ -0,0 +1,218 @@
+package lalash
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/w-haibara/lalash/history"
+)
+
+// HISTCONTROL is a list of these options separated by ":".
+const (
+	histIgnoreDups  = "ignoredups"  // skip a line equal to the previous one
+	histIgnoreSpace = "ignorespace" // skip a line starting with a space
+	histIgnoreBoth  = "ignoreboth"  // both of the above
+	histEraseDups   = "erasedups"   // remove older entries equal to a new line
+)
+
+// openHistory opens the history file named by HISTFILE, or the one in the
+// XDG state directory, keeping HISTSIZE entries.
+func (cmd Command) openHistory() (*history.History, error) {
+	path, ok := cmd.Internal.loadVar("HISTFILE")
+	if !ok {
+		path = history.DefaultPath()
+	}
+	if path != "" {
+		p, err := cmd.absPath(path)
+		if err != nil {
+			return nil, err
+		}
+		path = p
+	}
+
+	size := history.DefaultSize
+	if v, ok := cmd.Internal.loadVar("HISTSIZE"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid HISTSIZE: %v", v)
+		}
+		size = n
+	}
+
+	return history.Open(path, size)
+}
+
+func (cmd Command) historyOptions() (history.Options, error) {
+	opts := history.Options{}
+
+	v, _ := cmd.Internal.loadVar("HISTCONTROL")
+	for _, v := range strings.Split(v, ":") {
+		switch v {
+		case "":
+		case histIgnoreDups:
+			opts.IgnoreDups = true
+		case histIgnoreSpace:
+			opts.IgnoreSpace = true
+		case histIgnoreBoth:
+			opts.IgnoreDups = true
+			opts.IgnoreSpace = true
+		case histEraseDups:
+			opts.EraseDups = true
+		default:
+			return opts, fmt.Errorf("invalid HISTCONTROL: %v", v)
+		}
+	}
+
+	return opts, nil
+}
+
+// addHistory records a command line which has been evaluated, with the
+// status it ended with. It reports whether the line was added.
+func (cmd Command) addHistory(line string) (bool, error) {
+	if cmd.hist == nil {
+		return false, nil
+	}
+
+	opts, err := cmd.historyOptions()
+	if err != nil {
+		return false, err
+	}
+
+	status, _ := cmd.last.get()
+
+	return cmd.hist.Add(history.Entry{
+		Time:   time.Now(),
+		Cwd:    cmd.wd.get(),
+		Status: status,
+		Line:   line,
+	}, opts)
+}
+
+// AUTOSUGGEST selects the lines which the REPL suggests as a line is typed.
+const (
+	suggestHistory = "history" // the newest line in the history (default)
+	suggestCwd     = "cwd"     // the newest line run in the working directory
+	suggestOff     = "off"     // no suggestions
+)
+
+// suggest returns the line of the history which the REPL suggests for line.
+func (cmd Command) suggest(line string) string {
+	if cmd.hist == nil || strings.TrimSpace(line) == "" {
+		return ""
+	}
+
+	cwd := ""
+	switch v, _ := cmd.Internal.loadVar("AUTOSUGGEST"); v {
+	case "", suggestHistory:
+	case suggestCwd:
+		cwd = cmd.wd.get()
+	default:
+		return ""
+	}
+
+	s, _ := cmd.hist.Suggest(line, cwd)
+	return s
+}
+
+// historyIndex converts the number of an entry, counted from 1 for the oldest
+// one or from -1 for the newest one, to its index.
+func historyIndex(n, length int) (int, error) {
+	i := n - 1
+	if n < 0 {
+		i = length + n
+	}
+	if n == 0 || i < 0 || i >= length {
+		return 0, fmt.Errorf("no such history entry: %v", n)
+	}
+	return i, nil
+}
+
+// historyRunKey marks the context of an entry run by l-history --run, which
+// must not run another entry, or it may run itself forever.
+type historyRunKey struct{}
+
+func (cmd Command) setInternalHistoryFamily() {
+	cmd.Internal.Cmds.Store("l-history", InternalCmd{
+		Synopsis: "l-history [-n count] [-v] [--search text] | --delete n | --run n",
+		Desc: "Lists the command history, or deletes or runs an entry of it.\n" +
+			"The entries are numbered from 1 for the oldest one, and a negative number counts from the newest one. The history is kept in HISTFILE, up to HISTSIZE entries, and HISTCONTROL controls which lines are added.",
+		Flags: []Flag{
+			{Name: "n", Value: 0, Arg: "count", Usage: "list the last count entries"},
+			{Name: "v", Value: false, Usage: "show the time, the exit status and the directory of each entry"},
+			{Name: "search", Value: "", Arg: "text", Usage: "list the entries which contain text"},
+			{Name: "delete", Value: 0, Arg: "n", Usage: "delete the entry n"},
+			{Name: "run", Value: 0, Arg: "n", Usage: "run the entry n again"},
+		},
+		Examples: []string{
+			"l-history -n 10",
+			"l-history --search git",
+			"l-history --run -1",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-history", argv)
+			if err != nil {
+				return err
+			}
+			count := flagInt(f, "n")
+			verbose := flagBool(f, "v")
+			search := flagString(f, "search")
+			del := flagInt(f, "delete")
+			run := flagInt(f, "run")
+
+			if cmd.hist == nil {
+				return fmt.Errorf("history is not enabled")
+			}
+
+			entries := cmd.hist.Entries()
+
+			switch {
+			case del != 0:
+				i, err := historyIndex(del, len(entries))
+				if err != nil {
+					return err
+				}
+				return cmd.hist.Delete(i)
+
+			case run != 0:
+				if ctx.Value(historyRunKey{}) != nil {
+					return fmt.Errorf("cannot run a history entry from another one")
+				}
+				i, err := historyIndex(run, len(entries))
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.Stderr, entries[i].Line)
+				return EvalString(context.WithValue(ctx, historyRunKey{}, true), cmd, entries[i].Line)
+			}
+
+			nums := []int{}
+			for i, e := range entries {
+				if strings.Contains(e.Line, search) {
+					nums = append(nums, i)
+				}
+			}
+			if count > 0 && count < len(nums) {
+				nums = nums[len(nums)-count:]
+			}
+
+			for _, i := range nums {
+				e := entries[i]
+				if !verbose {
+					fmt.Fprintf(cmd.Stdout, "%5d  %v\n", i+1, e.Line)
+					continue
+				}
+
+				t := "-"
+				if !e.Time.IsZero() {
+					t = e.Time.Format("2006-01-02 15:04:05")
+				}
+				fmt.Fprintf(cmd.Stdout, "%5d  %v  %3d  %v  %v\n", i+1, t, e.Status, abbrevHome(e.Cwd), e.Line)
+			}
+
+			return nil
+		},
+	})
+}
@@ -0,0 +1,273 @@
+package lalash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/w-haibara/lalash/parser"
+)
+
+// module is a file loaded by l-import. Its functions are evaluated in its own
+// scope, so that they can call each other and use its globals.
+type module struct {
+	path     string
+	internal Internal
+}
+
+type importStackKey struct{}
+
+// importStack returns the paths of the modules being loaded by ctx, from the
+// outermost one.
+func importStack(ctx context.Context) []string {
+	s, _ := ctx.Value(importStackKey{}).([]string)
+	return s
+}
+
+// findModule returns the path of the module name. Names starting with "." are
+// relative to the directory of the module importing it, or to the working
+// directory outside of modules. The others are searched in the directories of
+// LALASH_PATH before the working directory. The ".lsh" extension may be
+// omitted.
+func (cmd Command) findModule(ctx context.Context, name string) (string, error) {
+	candidates := []string{name}
+	if filepath.Ext(name) == "" {
+		candidates = append(candidates, name+".lsh")
+	}
+
+	dirs := []string{}
+	if !filepath.IsAbs(name) && !strings.HasPrefix(name, ".") {
+		path, ok := cmd.Internal.loadVar("LALASH_PATH")
+		if !ok {
+			path = os.Getenv("LALASH_PATH")
+		}
+
+		for _, v := range filepath.SplitList(path) {
+			if v != "" {
+				dirs = append(dirs, v)
+			}
+		}
+	}
+
+	base := ""
+	if stack := importStack(ctx); strings.HasPrefix(name, ".") && len(stack) > 0 {
+		base = filepath.Dir(stack[len(stack)-1])
+	}
+	dirs = append(dirs, base)
+
+	for _, dir := range dirs {
+		for _, v := range candidates {
+			p, err := cmd.absPath(filepath.Join(dir, v))
+			if err != nil {
+				return "", err
+			}
+			if info, err := os.Stat(p); err == nil && !info.IsDir() {
+				return p, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("module not found: %v", name)
+}
+
+// loadModule evaluates the file at path once, and returns the module it
+// defines.
+func (cmd Command) loadModule(ctx context.Context, path string) (*module, error) {
+	stack := importStack(ctx)
+	for i, v := range stack {
+		if v == path {
+			cycle := []string{}
+			for _, v := range append(stack[i:], path) {
+				cycle = append(cycle, cmd.relPath(v))
+			}
+			return nil, fmt.Errorf("import cycle: %v", strings.Join(cycle, " -> "))
+		}
+	}
+
+	if v, ok := cmd.Internal.Modules.Load(path); ok {
+		return v.(*module), nil
+	}
+
+	m := &module{
+		path:     path,
+		internal: cmd.Internal,
+	}
+	m.internal.Alias = new(sync.Map)
+	m.internal.MutVar = new(sync.Map)
+	m.internal.Var = new(sync.Map)
+	m.internal.GlobalMutVar = new(sync.Map)
+	m.internal.GlobalVar = new(sync.Map)
+	m.internal.Args = new(sync.Map)
+	m.internal.Return = new(sync.Map)
+	m.internal.Imports = new(sync.Map)
+	m.internal.FuncPos = new(sync.Map)
+
+	c := cmd
+	c.Internal = m.internal
+
+	ctx = context.WithValue(ctx, importStackKey{}, append(stack[:len(stack):len(stack)], path))
+	if err := sourceFile(ctx, c, path); err != nil {
+		return nil, fmt.Errorf("%v: %v", cmd.relPath(path), err)
+	}
+
+	v, _ := cmd.Internal.Modules.LoadOrStore(path, m)
+
+	return v.(*module), nil
+}
+
+// moduleCall returns the alias which calls the function fn of the module
+// loaded from path.
+func moduleCall(path, fn string) string {
+	return "l-import --call {" + path + "} " + fn
+}
+
+// moduleFunc returns the path of the module and the function which the alias
+// v calls, if it is a function of a module.
+func moduleFunc(v string) (path, fn string, ok bool) {
+	tokens, err := parser.Parse(v)
+	if err != nil || len(tokens) != 4 || tokens[0].Val != "l-import" || tokens[1].Val != "--call" {
+		return "", "", false
+	}
+	return tokens[2].Val, tokens[3].Val, true
+}
+
+// exportModule makes the functions and variables of m available as
+// "name.fn" and "name.var". The modules imported by m are not exported.
+func (cmd Command) exportModule(name string, m *module) {
+	imported := func(key string) bool {
+		i := strings.Index(key, ".")
+		if i < 0 {
+			return false
+		}
+		_, ok := m.internal.Imports.Load(key[:i])
+		return ok
+	}
+
+	m.internal.Alias.Range(func(key, value interface{}) bool {
+		if fn := key.(string); !imported(fn) {
+			cmd.Internal.Alias.Store(name+"."+fn, moduleCall(m.path, fn))
+		}
+		return true
+	})
+
+	for _, v := range []struct {
+		from, to *sync.Map
+	}{
+		{m.internal.Var, cmd.Internal.GlobalVar},
+		{m.internal.GlobalVar, cmd.Internal.GlobalVar},
+		{m.internal.MutVar, cmd.Internal.GlobalMutVar},
+		{m.internal.GlobalMutVar, cmd.Internal.GlobalMutVar},
+	} {
+		to := v.to
+		v.from.Range(func(key, value interface{}) bool {
+			if !imported(key.(string)) {
+				to.Store(name+"."+key.(string), value)
+			}
+			return true
+		})
+	}
+}
+
+func (cmd Command) setInternalImportFamily() {
+	cmd.Internal.Cmds.Store("l-import", InternalCmd{
+		Synopsis: "l-import <path> [as <name>] | --list | --call <path> <fn> [args...]",
+		Desc: "Loads the file at path as a module, named after the file unless a name is given.\n" +
+			`The functions and variables of the module are used as name.fn and name.var. A path starting with "." is relative to the module importing it, a path not starting with "." or "/" is looked up in the directories of LALASH_PATH first, and the ".lsh" extension may be omitted.`,
+		Flags: []Flag{
+			{Name: "list", Value: false, Usage: "list the modules with their paths"},
+			{Name: "call", Value: "", Arg: "path", Usage: "call the function fn of the module loaded from path, as name.fn does"},
+		},
+		Examples: []string{
+			"l-import ./lib/util.lsh as u; u.greet world",
+			"l-import --list",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-import", argv)
+			if err != nil {
+				return err
+			}
+			list := flagBool(f, "list")
+			call := flagString(f, "call")
+
+			if call != "" {
+				if err := checkArgv(f.Args(), 1); err != nil {
+					return err
+				}
+
+				v, ok := cmd.Internal.Modules.Load(call)
+				if !ok {
+					return fmt.Errorf("module not loaded: %v", cmd.relPath(call))
+				}
+
+				// The function runs in the scope of its module, and
+				// returns its values to the caller.
+				in := v.(*module).internal
+				in.Return = cmd.Internal.Return
+
+				c := cmd
+				c.Internal = in
+
+				return callFunc(ctx, c, f.Arg(0), f.Args()[1:]...)
+			}
+
+			if list {
+				names := []string{}
+				cmd.Internal.Imports.Range(func(key, value interface{}) bool {
+					names = append(names, key.(string))
+					return true
+				})
+				sort.Strings(names)
+
+				for _, name := range names {
+					v, _ := cmd.Internal.Imports.Load(name)
+					fmt.Fprintln(cmd.Stdout, name, ":", cmd.relPath(v.(string)))
+				}
+
+				return nil
+			}
+
+			argv = f.Args()
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			name := strings.TrimSuffix(filepath.Base(argv[0]), filepath.Ext(argv[0]))
+			switch {
+			case len(argv) == 3 && argv[1] == "as":
+				name = argv[2]
+			case len(argv) != 1:
+				return fmt.Errorf("usage: l-import <path> [as <name>]")
+			}
+
+			if name == "" || strings.ContainsAny(name, ". \t") {
+				return fmt.Errorf("invalid module name: %v", name)
+			}
+
+			path, err := cmd.findModule(ctx, argv[0])
+			if err != nil {
+				return err
+			}
+
+			if v, ok := cmd.Internal.Imports.Load(name); ok {
+				if v.(string) == path {
+					return nil
+				}
+				return fmt.Errorf("module name already used: %v (%v)", name, cmd.relPath(v.(string)))
+			}
+
+			m, err := cmd.loadModule(ctx, path)
+			if err != nil {
+				return err
+			}
+
+			cmd.exportModule(name, m)
+			cmd.Internal.Imports.Store(name, path)
+
+			return nil
+		},
+	})
+}
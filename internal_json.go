@@ -0,0 +1,877 @@
+package lalash
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type jsonPathElem struct {
+	key      string
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses paths such as ".a.b[0].c", "a.*.name" or
+// `.["key.with.dots"][*]`. "." and "" refer to the whole document.
+func parseJSONPath(path string) ([]jsonPathElem, error) {
+	res := []jsonPathElem{}
+	s := path
+	for s != "" {
+		switch {
+		case strings.HasPrefix(s, "."):
+			s = s[1:]
+
+		case strings.HasPrefix(s, "["):
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("%v: bracket not terminated", path)
+			}
+			k := s[1:end]
+			s = s[end+1:]
+
+			switch {
+			case k == "*":
+				res = append(res, jsonPathElem{wildcard: true})
+			case strings.HasPrefix(k, "\"") && strings.HasSuffix(k, "\"") && len(k) >= 2:
+				res = append(res, jsonPathElem{key: k[1 : len(k)-1]})
+			default:
+				if _, err := strconv.Atoi(k); err != nil {
+					return nil, fmt.Errorf("%v: invalid index: %v", path, k)
+				}
+				res = append(res, jsonPathElem{key: k, isIndex: true})
+			}
+
+		default:
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			k := s[:end]
+			s = s[end:]
+
+			if k == "*" {
+				res = append(res, jsonPathElem{wildcard: true})
+				continue
+			}
+			res = append(res, jsonPathElem{key: k})
+		}
+	}
+	return res, nil
+}
+
+func jsonPathString(path []jsonPathElem) string {
+	s := ""
+	for _, v := range path {
+		switch {
+		case v.wildcard:
+			s += "[*]"
+		case v.isIndex:
+			s += "[" + v.key + "]"
+		case strings.ContainsAny(v.key, ".[]"):
+			s += "[\"" + v.key + "\"]"
+		default:
+			s += "." + v.key
+		}
+	}
+	if s == "" {
+		return "."
+	}
+	return s
+}
+
+func jsonIndex(path []jsonPathElem, key string, length int) (int, error) {
+	i, err := strconv.Atoi(key)
+	if err != nil {
+		return 0, fmt.Errorf("%v: cannot index array with key %q", jsonPathString(path), key)
+	}
+	if i < 0 {
+		i += length
+	}
+	if i < 0 || i >= length {
+		return 0, fmt.Errorf("%v: index out of range (length %d)", jsonPathString(path), length)
+	}
+	return i, nil
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return "unknown"
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonGet(v interface{}, path []jsonPathElem) ([]interface{}, error) {
+	vs := []interface{}{v}
+	for n, e := range path {
+		next := []interface{}{}
+		for _, v := range vs {
+			switch v := v.(type) {
+			case map[string]interface{}:
+				if e.wildcard {
+					for _, k := range sortedKeys(v) {
+						next = append(next, v[k])
+					}
+					continue
+				}
+				c, ok := v[e.key]
+				if !ok {
+					return nil, fmt.Errorf("%v: key not found", jsonPathString(path[:n+1]))
+				}
+				next = append(next, c)
+
+			case []interface{}:
+				if e.wildcard {
+					next = append(next, v...)
+					continue
+				}
+				i, err := jsonIndex(path[:n+1], e.key, len(v))
+				if err != nil {
+					return nil, err
+				}
+				next = append(next, v[i])
+
+			default:
+				return nil, fmt.Errorf("%v: cannot index %v", jsonPathString(path[:n+1]), jsonType(v))
+			}
+		}
+		vs = next
+	}
+	return vs, nil
+}
+
+// jsonSet returns v with the value at path replaced by val. Missing objects
+// are created on the way; an index equal to the length of an array appends.
+func jsonSet(v interface{}, path []jsonPathElem, n int, val interface{}) (interface{}, error) {
+	if n == len(path) {
+		return val, nil
+	}
+	e := path[n]
+
+	switch c := v.(type) {
+	case map[string]interface{}:
+		if e.wildcard {
+			for k := range c {
+				res, err := jsonSet(c[k], path, n+1, val)
+				if err != nil {
+					return nil, err
+				}
+				c[k] = res
+			}
+			return c, nil
+		}
+		res, err := jsonSet(c[e.key], path, n+1, val)
+		if err != nil {
+			return nil, err
+		}
+		c[e.key] = res
+		return c, nil
+
+	case []interface{}:
+		if e.wildcard {
+			for i := range c {
+				res, err := jsonSet(c[i], path, n+1, val)
+				if err != nil {
+					return nil, err
+				}
+				c[i] = res
+			}
+			return c, nil
+		}
+		if e.key == strconv.Itoa(len(c)) {
+			c = append(c, nil)
+		}
+		i, err := jsonIndex(path[:n+1], e.key, len(c))
+		if err != nil {
+			return nil, err
+		}
+		res, err := jsonSet(c[i], path, n+1, val)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = res
+		return c, nil
+
+	case nil:
+		if e.wildcard {
+			return nil, fmt.Errorf("%v: cannot expand wildcard on null", jsonPathString(path[:n+1]))
+		}
+		if e.isIndex {
+			return jsonSet([]interface{}{}, path, n, val)
+		}
+		return jsonSet(map[string]interface{}{}, path, n, val)
+	}
+
+	return nil, fmt.Errorf("%v: cannot index %v", jsonPathString(path[:n+1]), jsonType(v))
+}
+
+func jsonDel(v interface{}, path []jsonPathElem, n int) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	e := path[n]
+	last := n == len(path)-1
+
+	switch c := v.(type) {
+	case map[string]interface{}:
+		keys := []string{e.key}
+		if e.wildcard {
+			keys = sortedKeys(c)
+		}
+		for _, k := range keys {
+			if _, ok := c[k]; !ok {
+				return nil, fmt.Errorf("%v: key not found", jsonPathString(path[:n+1]))
+			}
+			if last {
+				delete(c, k)
+				continue
+			}
+			res, err := jsonDel(c[k], path, n+1)
+			if err != nil {
+				return nil, err
+			}
+			c[k] = res
+		}
+		return c, nil
+
+	case []interface{}:
+		if e.wildcard {
+			if last {
+				return []interface{}{}, nil
+			}
+			for i := range c {
+				res, err := jsonDel(c[i], path, n+1)
+				if err != nil {
+					return nil, err
+				}
+				c[i] = res
+			}
+			return c, nil
+		}
+		i, err := jsonIndex(path[:n+1], e.key, len(c))
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			return append(c[:i], c[i+1:]...), nil
+		}
+		res, err := jsonDel(c[i], path, n+1)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = res
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("%v: cannot index %v", jsonPathString(path[:n+1]), jsonType(v))
+}
+
+func decodeJSON(s string) (interface{}, error) {
+	var v interface{}
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if d.More() {
+		return nil, fmt.Errorf("invalid JSON: trailing data")
+	}
+	return v, nil
+}
+
+// encodeJSON returns v encoded in a single line, terminated by a newline.
+func encodeJSON(v interface{}) (string, error) {
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// printJSON prints v; strings are printed as is unless quote is set.
+func printJSON(cmd Command, v interface{}, quote bool) error {
+	if s, ok := v.(string); ok && !quote {
+		fmt.Fprintln(cmd.Stdout, s)
+		return nil
+	}
+
+	s, err := encodeJSON(v)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(cmd.Stdout, s)
+
+	return nil
+}
+
+// jsonAt decodes the document given as argv[n] or stdin and returns the
+// value at path.
+func jsonAt(cmd Command, argv []string, n int, path string) (interface{}, error) {
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := subject(cmd, argv, n)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := decodeJSON(s)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := jsonGet(v, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) != 1 {
+		return nil, fmt.Errorf("%v: path matches %d values", path, len(res))
+	}
+
+	return res[0], nil
+}
+
+// jsonVar is the value of a variable defined by j-to-var for a JSON value
+// which is not a string, such as a number or an empty object. It reads as s,
+// and j-from-var turns it back into v.
+type jsonVar struct {
+	s string
+	v interface{}
+}
+
+// flattenJSON calls f with the variables which j-to-var defines for v. A
+// string is stored as it is, and the other values as jsonVars.
+func flattenJSON(name string, v interface{}, f func(name string, value interface{})) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			f(name, jsonVar{s: "{}", v: v})
+		}
+		for _, k := range sortedKeys(v) {
+			flattenJSON(name+"."+k, v[k], f)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			f(name, jsonVar{s: "[]", v: v})
+		}
+		for i, c := range v {
+			flattenJSON(name+"."+strconv.Itoa(i), c, f)
+		}
+	case string:
+		f(name, v)
+	case nil:
+		f(name, jsonVar{s: "null"})
+	default:
+		f(name, jsonVar{s: fmt.Sprint(v), v: v})
+	}
+}
+
+// jsonOfVar returns the JSON value of a variable whose value is stored as
+// value.
+func jsonOfVar(value interface{}) interface{} {
+	v, ok := value.(jsonVar)
+	if !ok {
+		s, _ := varString(value)
+		return s
+	}
+
+	// The containers are new, so that they are not changed with the
+	// document they are put in.
+	switch v.v.(type) {
+	case map[string]interface{}:
+		return map[string]interface{}{}
+	case []interface{}:
+		return []interface{}{}
+	}
+	return v.v
+}
+
+// loadJSONVar returns the JSON value of the variable name.
+func (i Internal) loadJSONVar(name string) (interface{}, bool) {
+	for _, m := range []*sync.Map{i.Var, i.MutVar, i.GlobalVar, i.GlobalMutVar} {
+		if v, ok := m.Load(name); ok {
+			if _, ok := varString(v); ok {
+				return jsonOfVar(v), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// unflattenJSON is the inverse of flattenJSON: objects whose keys are exactly
+// 0 to n-1 become arrays.
+func unflattenJSON(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+
+	for k, c := range m {
+		m[k] = unflattenJSON(c)
+	}
+
+	if len(m) == 0 {
+		return m
+	}
+
+	arr := make([]interface{}, len(m))
+	for i := range arr {
+		c, ok := m[strconv.Itoa(i)]
+		if !ok {
+			return m
+		}
+		arr[i] = c
+	}
+
+	return arr
+}
+
+func (cmd Command) setInternalJSONFamily() {
+	cmd.Internal.Cmds.Store("j-get", InternalCmd{
+		Synopsis: "j-get [--json] <path> [json]",
+		Desc: "Prints the values at path in a JSON document.\n" +
+			`The document is read from the standard input if it is not given. Paths are written such as ".a.b[0]", "a.*.name" or .["key.with.dots"], where "*" matches all the elements. Strings are printed without quotes unless --json is given.`,
+		Flags: []Flag{
+			{Name: "json", Value: false, Usage: "print strings as JSON"},
+		},
+		Examples: []string{
+			`j-get .name {{"name": "lalash"}}`,
+			"j-get .dependencies.* (f-read package.json)",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("j-get", argv)
+			if err != nil {
+				return err
+			}
+			quote := flagBool(f, "json")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			p, err := parseJSONPath(f.Arg(0))
+			if err != nil {
+				return err
+			}
+
+			s, err := subject(cmd, f.Args(), 1)
+			if err != nil {
+				return err
+			}
+
+			v, err := decodeJSON(s)
+			if err != nil {
+				return err
+			}
+
+			res, err := jsonGet(v, p)
+			if err != nil {
+				return err
+			}
+
+			for _, v := range res {
+				if err := printJSON(cmd, v, quote); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("j-set", InternalCmd{
+		Synopsis: "j-set [--string] <path> <value> [json]",
+		Desc: "Prints a JSON document with the value at path replaced.\n" +
+			"The value is read as JSON if it can be, and as a string otherwise. Missing objects are created, and an index equal to the length of an array appends to it.",
+		Flags: []Flag{
+			{Name: "string", Value: false, Usage: "set the value as a string"},
+		},
+		Examples: []string{
+			`j-set .version 2 {{"version": 1}}`,
+			"j-set --string .id 007 {{}}",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("j-set", argv)
+			if err != nil {
+				return err
+			}
+			isString := flagBool(f, "string")
+
+			if err := checkArgv(f.Args(), 2); err != nil {
+				return err
+			}
+
+			p, err := parseJSONPath(f.Arg(0))
+			if err != nil {
+				return err
+			}
+
+			var val interface{} = f.Arg(1)
+			if !isString {
+				if v, err := decodeJSON(f.Arg(1)); err == nil {
+					val = v
+				}
+			}
+
+			s, err := subject(cmd, f.Args(), 2)
+			if err != nil {
+				return err
+			}
+
+			v, err := decodeJSON(s)
+			if err != nil {
+				return err
+			}
+
+			v, err = jsonSet(v, p, 0, val)
+			if err != nil {
+				return err
+			}
+
+			return printJSON(cmd, v, true)
+		},
+	})
+
+	cmd.Internal.Cmds.Store("j-del", InternalCmd{
+		Synopsis: "j-del <path> [json]",
+		Desc:     "Prints a JSON document with the value at path removed.",
+		Examples: []string{`j-del .b {{"a": 1, "b": 2}}`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			p, err := parseJSONPath(argv[0])
+			if err != nil {
+				return err
+			}
+
+			s, err := subject(cmd, argv, 1)
+			if err != nil {
+				return err
+			}
+
+			v, err := decodeJSON(s)
+			if err != nil {
+				return err
+			}
+
+			v, err = jsonDel(v, p, 0)
+			if err != nil {
+				return err
+			}
+
+			return printJSON(cmd, v, true)
+		},
+	})
+
+	cmd.Internal.Cmds.Store("j-keys", InternalCmd{
+		Synopsis: "j-keys [-p path] [json]",
+		Desc:     "Prints the keys of an object in sorted order, or the indexes of an array.",
+		Flags: []Flag{
+			{Name: "p", Value: ".", Arg: "path", Usage: "print the keys of the value at path"},
+		},
+		Examples: []string{`j-keys {{"b": 1, "a": 2}}`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("j-keys", argv)
+			if err != nil {
+				return err
+			}
+			path := flagString(f, "p")
+
+			v, err := jsonAt(cmd, f.Args(), 0, path)
+			if err != nil {
+				return err
+			}
+
+			switch v := v.(type) {
+			case map[string]interface{}:
+				for _, k := range sortedKeys(v) {
+					fmt.Fprintln(cmd.Stdout, k)
+				}
+			case []interface{}:
+				for i := range v {
+					fmt.Fprintln(cmd.Stdout, i)
+				}
+			default:
+				return fmt.Errorf("%v: %v has no keys", path, jsonType(v))
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("j-len", InternalCmd{
+		Synopsis: "j-len [-p path] [json]",
+		Desc:     "Prints the number of the elements of an object or an array, or of the characters of a string.",
+		Flags: []Flag{
+			{Name: "p", Value: ".", Arg: "path", Usage: "print the length of the value at path"},
+		},
+		Examples: []string{`j-len -p .items {{"items": [1, 2, 3]}}`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("j-len", argv)
+			if err != nil {
+				return err
+			}
+			path := flagString(f, "p")
+
+			v, err := jsonAt(cmd, f.Args(), 0, path)
+			if err != nil {
+				return err
+			}
+
+			switch v := v.(type) {
+			case map[string]interface{}:
+				fmt.Fprintln(cmd.Stdout, len(v))
+			case []interface{}:
+				fmt.Fprintln(cmd.Stdout, len(v))
+			case string:
+				fmt.Fprintln(cmd.Stdout, len([]rune(v)))
+			default:
+				return fmt.Errorf("%v: %v has no length", path, jsonType(v))
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("j-type", InternalCmd{
+		Synopsis: "j-type [-p path] [json]",
+		Desc:     "Prints the type of a JSON value: object, array, string, number, boolean or null.",
+		Flags: []Flag{
+			{Name: "p", Value: ".", Arg: "path", Usage: "print the type of the value at path"},
+		},
+		Examples: []string{`j-type -p .a {{"a": [1]}}`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("j-type", argv)
+			if err != nil {
+				return err
+			}
+			path := flagString(f, "p")
+
+			v, err := jsonAt(cmd, f.Args(), 0, path)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, jsonType(v))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("j-pretty", InternalCmd{
+		Synopsis: "j-pretty [--indent text] [json]",
+		Desc:     "Prints a JSON document indented.",
+		Flags: []Flag{
+			{Name: "indent", Value: "  ", Arg: "text", Usage: "indent with text"},
+		},
+		Examples: []string{"j-pretty (f-read data.json)"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("j-pretty", argv)
+			if err != nil {
+				return err
+			}
+			indent := flagString(f, "indent")
+
+			s, err := subject(cmd, f.Args(), 0)
+			if err != nil {
+				return err
+			}
+
+			var b bytes.Buffer
+			if err := json.Indent(&b, []byte(s), "", indent); err != nil {
+				return fmt.Errorf("invalid JSON: %v", err)
+			}
+			fmt.Fprintln(cmd.Stdout, b.String())
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("j-compact", InternalCmd{
+		Synopsis: "j-compact [json]",
+		Desc:     "Prints a JSON document in a single line.",
+		Examples: []string{"j-compact (f-read data.json)"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			s, err := subject(cmd, argv, 0)
+			if err != nil {
+				return err
+			}
+
+			var b bytes.Buffer
+			if err := json.Compact(&b, []byte(s)); err != nil {
+				return fmt.Errorf("invalid JSON: %v", err)
+			}
+			fmt.Fprintln(cmd.Stdout, b.String())
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("j-from-var", InternalCmd{
+		Synopsis: "j-from-var <names...> | --list <name> | --prefix <prefix>",
+		Desc: "Prints an object of the variables, keyed by their names.\n" +
+			`With --list, it prints an array of the lines of a variable. With --prefix, it prints the object whose fields are the variables named "prefix.key", which is the inverse of j-to-var.`,
+		Flags: []Flag{
+			{Name: "list", Value: false, Usage: "print an array of the lines of the variable"},
+			{Name: "prefix", Value: "", Arg: "prefix", Usage: "print the object of the variables whose names begin with prefix and a dot"},
+		},
+		Examples: []string{
+			"l-var a 1; l-var b 2; j-from-var a b",
+			`j-to-var user {{"name": "x"}}; j-from-var --prefix user`,
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("j-from-var", argv)
+			if err != nil {
+				return err
+			}
+			isList := flagBool(f, "list")
+			prefix := flagString(f, "prefix")
+
+			if isList && prefix != "" {
+				return fmt.Errorf("cannot set both --list and --prefix")
+			}
+
+			switch {
+			case isList:
+				if err := checkArgv(f.Args(), 1); err != nil {
+					return err
+				}
+
+				v, ok := cmd.Internal.loadVar(f.Arg(0))
+				if !ok {
+					return fmt.Errorf("variable is not defined: %v", f.Arg(0))
+				}
+
+				list := []interface{}{}
+				for _, v := range strings.Split(strings.TrimSuffix(v, "\n"), "\n") {
+					list = append(list, v)
+				}
+				return printJSON(cmd, list, true)
+
+			case prefix != "":
+				root := map[string]interface{}{}
+				var err error
+				cmd.Internal.rangeVarValues(func(name string, value interface{}) {
+					if err != nil || !strings.HasPrefix(name, prefix+".") {
+						return
+					}
+
+					path := []jsonPathElem{}
+					for _, k := range strings.Split(strings.TrimPrefix(name, prefix+"."), ".") {
+						path = append(path, jsonPathElem{key: k})
+					}
+
+					_, err = jsonSet(root, path, 0, jsonOfVar(value))
+				})
+				if err != nil {
+					return err
+				}
+				return printJSON(cmd, unflattenJSON(root), true)
+			}
+
+			obj := map[string]interface{}{}
+			for _, name := range f.Args() {
+				v, ok := cmd.Internal.loadJSONVar(name)
+				if !ok {
+					return fmt.Errorf("variable is not defined: %v", name)
+				}
+				obj[name] = v
+			}
+
+			return printJSON(cmd, obj, true)
+		},
+	})
+
+	cmd.Internal.Cmds.Store("j-to-var", InternalCmd{
+		Synopsis: "j-to-var [--mut] [--global] [-p path] <name> [json]",
+		Desc: "Defines variables for a JSON value.\n" +
+			`A value which is not an object or an array is stored in the variable name, and the elements of objects and arrays in variables such as "name.key" and "name.0". An empty object or array is stored as "{}" or "[]", and j-from-var turns the variables back into the values they were defined with until they are changed.`,
+		Flags: []Flag{
+			{Name: "mut", Value: false, Usage: "define mutable variables"},
+			{Name: "global", Value: false, Usage: "define global variables"},
+			{Name: "p", Value: ".", Arg: "path", Usage: "define the variables for the value at path"},
+		},
+		Examples: []string{`j-to-var user {{"name": "x", "langs": ["go"]}}; l-echo (l-var --ref user.name) (l-var --ref user.langs.0)`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("j-to-var", argv)
+			if err != nil {
+				return err
+			}
+			isMut := flagBool(f, "mut")
+			isGlobal := flagBool(f, "global")
+			path := flagString(f, "p")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			if f.Arg(0) == "" {
+				return fmt.Errorf("key is blank")
+			}
+
+			v, err := jsonAt(cmd, f.Args(), 1, path)
+			if err != nil {
+				return err
+			}
+
+			varMap := cmd.Internal.Var
+			switch {
+			case isMut && isGlobal:
+				varMap = cmd.Internal.GlobalMutVar
+			case isMut:
+				varMap = cmd.Internal.MutVar
+			case isGlobal:
+				varMap = cmd.Internal.GlobalVar
+			}
+
+			vars := map[string]interface{}{}
+			flattenJSON(f.Arg(0), v, func(name string, value interface{}) {
+				vars[name] = value
+			})
+
+			for name := range vars {
+				if _, ok := cmd.Internal.loadVar(name); ok {
+					return fmt.Errorf("variable is already exists: %v", name)
+				}
+			}
+
+			for name, value := range vars {
+				varMap.Store(name, value)
+			}
+
+			return nil
+		},
+	})
+}
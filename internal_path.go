@@ -0,0 +1,222 @@
+package lalash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// expandTilde replaces a leading "~" or "~user" with the home directory.
+func expandTilde(s string) (string, error) {
+	if !strings.HasPrefix(s, "~") {
+		return s, nil
+	}
+
+	name := strings.TrimPrefix(s, "~")
+	rest := ""
+	if i := strings.Index(name, "/"); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+
+	if name == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return home + rest, nil
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+
+	return u.HomeDir + rest, nil
+}
+
+func (cmd Command) setInternalPathFamily() {
+	cmd.Internal.Cmds.Store("p-join", InternalCmd{
+		Synopsis: "p-join <elems...>",
+		Desc:     "Joins path elements with the separator of the system and prints the result.",
+		Examples: []string{"p-join a b c.txt"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, filepath.Join(argv...))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("p-base", InternalCmd{
+		Synopsis: "p-base <path>",
+		Desc:     "Prints the last element of a path.",
+		Examples: []string{"p-base /a/b.txt"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, filepath.Base(argv[0]))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("p-dir", InternalCmd{
+		Synopsis: "p-dir <path>",
+		Desc:     "Prints a path without its last element.",
+		Examples: []string{"p-dir /a/b.txt"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, filepath.Dir(argv[0]))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("p-ext", InternalCmd{
+		Synopsis: "p-ext <path>",
+		Desc:     "Prints the extension of a path, including the dot.",
+		Examples: []string{"p-ext a.tar.gz"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, filepath.Ext(argv[0]))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("p-abs", InternalCmd{
+		Synopsis: "p-abs <path>",
+		Desc:     "Prints the absolute path of a path relative to the working directory.",
+		Examples: []string{"p-abs ../a"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			p, err := cmd.absPath(argv[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, p)
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("p-rel", InternalCmd{
+		Synopsis: "p-rel <base> <target>",
+		Desc:     "Prints the path of target relative to base.",
+		Examples: []string{"p-rel /a /a/b/c"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			base, err := cmd.absPath(argv[0])
+			if err != nil {
+				return err
+			}
+
+			target, err := cmd.absPath(argv[1])
+			if err != nil {
+				return err
+			}
+
+			p, err := filepath.Rel(base, target)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, p)
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("p-clean", InternalCmd{
+		Synopsis: "p-clean <path>",
+		Desc:     `Prints the shortest path equivalent to a path, without "." and ".." elements and duplicated separators.`,
+		Examples: []string{"p-clean a//b/../c"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, filepath.Clean(argv[0]))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("p-split", InternalCmd{
+		Synopsis: "p-split <path>",
+		Desc:     "Prints the directory and the file name of a path on two lines.",
+		Examples: []string{"p-split /a/b.txt"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			dir, file := filepath.Split(argv[0])
+			fmt.Fprintln(cmd.Stdout, dir)
+			fmt.Fprintln(cmd.Stdout, file)
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("p-match", InternalCmd{
+		Synopsis: "p-match <pattern> <name>",
+		Desc:     `Prints whether name matches the shell pattern, such as "*.go".`,
+		Examples: []string{`p-match "*.go" main.go`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			ok, err := filepath.Match(argv[0], argv[1])
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, ok)
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("p-expand", InternalCmd{
+		Synopsis: "p-expand <path>",
+		Desc:     `Expands a leading "~" and the environment variables such as $HOME in a path.`,
+		Examples: []string{"p-expand ~/src"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			p, err := expandTilde(argv[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, os.ExpandEnv(p))
+
+			return nil
+		},
+	})
+}
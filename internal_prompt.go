@@ -0,0 +1,337 @@
+package lalash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPrompt = "$ "
+
+// lastLine is the result of the last command line of the shell.
+type lastLine struct {
+	mu      sync.Mutex
+	status  int
+	elapsed time.Duration
+}
+
+func (l *lastLine) set(err error, elapsed time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.status = exitStatus(err)
+	l.elapsed = elapsed
+}
+
+func (l *lastLine) get() (int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.status, l.elapsed
+}
+
+// exitStatus returns the exit status of a command line which ended with err.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var e *exec.ExitError
+	if errors.As(err, &e) && e.ExitCode() > 0 {
+		return e.ExitCode()
+	}
+
+	// Jobs report the status of their processes by themselves.
+	if s := strings.TrimPrefix(err.Error(), "exit status "); s != err.Error() {
+		if n, err := strconv.Atoi(s); err == nil {
+			return n
+		}
+	}
+
+	return 1
+}
+
+var ansiColors = map[string]int{
+	"reset":     0,
+	"bold":      1,
+	"dim":       2,
+	"italic":    3,
+	"underline": 4,
+	"black":     30,
+	"red":       31,
+	"green":     32,
+	"yellow":    33,
+	"blue":      34,
+	"magenta":   35,
+	"cyan":      36,
+	"white":     37,
+}
+
+// ansiCode returns the escape sequence of colors and attributes separated by
+// ",", such as "red,bold".
+func ansiCode(spec string) (string, error) {
+	codes := []string{}
+	for _, v := range strings.Split(spec, ",") {
+		code, ok := ansiColors[v]
+		if !ok {
+			return "", fmt.Errorf("invalid color: %v", v)
+		}
+		codes = append(codes, strconv.Itoa(code))
+	}
+
+	return "\x1b[" + strings.Join(codes, ";") + "m", nil
+}
+
+// abbrevHome replaces the home directory at the start of dir with "~".
+func abbrevHome(dir string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return dir
+	}
+
+	if dir == home {
+		return "~"
+	}
+	if strings.HasPrefix(dir, home+string(filepath.Separator)) {
+		return "~" + strings.TrimPrefix(dir, home)
+	}
+
+	return dir
+}
+
+// gitBranch returns the branch checked out in the git repository containing
+// dir, or the abbreviated commit if HEAD is detached. It reads .git/HEAD
+// instead of running git, which would be too slow for every prompt.
+func gitBranch(dir string) (string, bool) {
+	for {
+		gitDir := filepath.Join(dir, ".git")
+		if info, err := os.Stat(gitDir); err == nil {
+			if !info.IsDir() {
+				// A worktree or submodule points to its git directory.
+				b, err := os.ReadFile(gitDir)
+				if err != nil {
+					return "", false
+				}
+				p := strings.TrimSpace(strings.TrimPrefix(string(b), "gitdir:"))
+				if !filepath.IsAbs(p) {
+					p = filepath.Join(dir, p)
+				}
+				gitDir = p
+			}
+
+			b, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+			if err != nil {
+				return "", false
+			}
+
+			head := strings.TrimSpace(string(b))
+			if ref := strings.TrimPrefix(head, "ref: "); ref != head {
+				return strings.TrimPrefix(ref, "refs/heads/"), true
+			}
+			if len(head) > 7 {
+				head = head[:7]
+			}
+			return head, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// prompt returns the prompt of the REPL, which is the output of the l-prompt
+// function or else the PROMPT variable. If the function fails, the error is
+// reported and the default prompt is used.
+func (cmd Command) prompt(ctx context.Context) string {
+	if _, ok := cmd.Internal.Alias.Load("l-prompt"); ok {
+		p, err := callFuncOutput(ctx, cmd, "l-prompt")
+		if err != nil {
+			fmt.Fprintln(cmd.Stderr, "l-prompt:", err.Error())
+			return defaultPrompt
+		}
+		return p
+	}
+
+	if p, ok := cmd.Internal.loadVar("PROMPT"); ok {
+		return p
+	}
+
+	return defaultPrompt
+}
+
+func (cmd Command) setInternalPromptFamily() {
+	cmd.Internal.Cmds.Store("pr-cwd", InternalCmd{
+		Synopsis: "pr-cwd [-b]",
+		Desc:     `Prints the working directory, with the home directory abbreviated to "~".`,
+		Flags: []Flag{
+			{Name: "b", Value: false, Usage: "print only the last element of the directory"},
+		},
+		Examples: []string{`l-fn l-prompt {l-echo (pr-cwd) "$ "}`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("pr-cwd", argv)
+			if err != nil {
+				return err
+			}
+			base := flagBool(f, "b")
+
+			dir, err := cmd.absPath(".")
+			if err != nil {
+				return err
+			}
+
+			if base {
+				fmt.Fprintln(cmd.Stdout, filepath.Base(dir))
+				return nil
+			}
+
+			fmt.Fprintln(cmd.Stdout, abbrevHome(dir))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("pr-status", InternalCmd{
+		Synopsis: "pr-status",
+		Desc:     "Prints the exit status of the last command line.",
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			status, _ := cmd.last.get()
+			fmt.Fprintln(cmd.Stdout, status)
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("pr-mode", InternalCmd{
+		Synopsis: "pr-mode",
+		Desc: "Prints the keymap of the line editor in use, such as \"vi-command\".\n" +
+			"The prompt is shown again when the keymap changes, so that it can show the mode.",
+		Examples: []string{`l-fn l-prompt {l-echo "[" (pr-mode) "] $ "}`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if cmd.line == nil {
+				return nil
+			}
+
+			fmt.Fprintln(cmd.Stdout, cmd.line.Keymap())
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("pr-elapsed", InternalCmd{
+		Synopsis: "pr-elapsed [--min duration]",
+		Desc:     "Prints the time which the last command line took.",
+		Flags: []Flag{
+			{Name: "min", Value: time.Duration(0), Arg: "duration", Usage: `print nothing if it took less than duration, such as "2s"`},
+		},
+		Examples: []string{"pr-elapsed --min 5s"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("pr-elapsed", argv)
+			if err != nil {
+				return err
+			}
+			min := flagDuration(f, "min")
+
+			_, elapsed := cmd.last.get()
+			if elapsed < min {
+				return nil
+			}
+
+			fmt.Fprintln(cmd.Stdout, elapsed.Round(time.Millisecond))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("pr-git-branch", InternalCmd{
+		Synopsis: "pr-git-branch",
+		Desc:     "Prints the branch of the git repository of the working directory, or nothing outside of a repository.",
+		Examples: []string{`l-fn l-prompt {l-echo (pr-cwd) (pr-git-branch) "$ "}`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			dir, err := cmd.absPath(".")
+			if err != nil {
+				return err
+			}
+
+			if branch, ok := gitBranch(dir); ok {
+				fmt.Fprintln(cmd.Stdout, branch)
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("pr-user", InternalCmd{
+		Synopsis: "pr-user",
+		Desc:     "Prints the name of the user.",
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			u, err := user.Current()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, u.Username)
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("pr-host", InternalCmd{
+		Synopsis: "pr-host [-s]",
+		Desc:     "Prints the host name.",
+		Flags: []Flag{
+			{Name: "s", Value: false, Usage: "print the name up to the first dot"},
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("pr-host", argv)
+			if err != nil {
+				return err
+			}
+			short := flagBool(f, "s")
+
+			host, err := os.Hostname()
+			if err != nil {
+				return err
+			}
+
+			if short {
+				host = strings.SplitN(host, ".", 2)[0]
+			}
+
+			fmt.Fprintln(cmd.Stdout, host)
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("pr-color", InternalCmd{
+		Synopsis: "pr-color <color[,attr...]> <text...>",
+		Desc: "Prints text in colors.\n" +
+			"The colors are black, red, green, yellow, blue, magenta, cyan and white, and the attributes are bold, dim, italic, underline and reset.",
+		Examples: []string{"pr-color green,bold (pr-cwd)"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			code, err := ansiCode(argv[0])
+			if err != nil {
+				return err
+			}
+
+			text := strings.Join(argv[1:], " ")
+			fmt.Fprintf(cmd.Stdout, "%v%v\x1b[0m\n", code, text)
+
+			return nil
+		},
+	})
+}
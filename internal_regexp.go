@@ -0,0 +1,289 @@
+package lalash
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// maxRegexps is the number of compiled patterns cached. The cache is cleared
+// when it is full.
+const maxRegexps = 128
+
+func (i Internal) compileRegexp(expr string) (*regexp.Regexp, error) {
+	if v, ok := i.Regexp.Load(expr); ok {
+		if re, ok := v.(*regexp.Regexp); ok {
+			return re, nil
+		}
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	n := 0
+	i.Regexp.Range(func(key, value interface{}) bool {
+		n++
+		return true
+	})
+	if n >= maxRegexps {
+		i.Regexp.Range(func(key, value interface{}) bool {
+			i.Regexp.Delete(key)
+			return true
+		})
+	}
+
+	i.Regexp.Store(expr, re)
+
+	return re, nil
+}
+
+func (cmd Command) setInternalRegexpFamily() {
+	cmd.Internal.Cmds.Store("r-match", InternalCmd{
+		Synopsis: "r-match <regexp> [text]",
+		Desc: "Prints whether text contains a match of the regular expression.\n" +
+			"The text is read from the standard input if it is not given. The syntax is that of the regexp package of Go.",
+		Examples: []string{`r-match "^[0-9]+$" 123`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			re, err := cmd.Internal.compileRegexp(argv[0])
+			if err != nil {
+				return err
+			}
+
+			s, err := subject(cmd, argv, 1)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, re.MatchString(s))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("r-find", InternalCmd{
+		Synopsis: "r-find <regexp> [text]",
+		Desc: "Prints the first match of the regular expression in text.\n" +
+			"The text is read from the standard input if it is not given.",
+		Examples: []string{`r-find "[0-9]+" abc123def`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			re, err := cmd.Internal.compileRegexp(argv[0])
+			if err != nil {
+				return err
+			}
+
+			s, err := subject(cmd, argv, 1)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, re.FindString(s))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("r-find-all", InternalCmd{
+		Synopsis: "r-find-all [-n count] <regexp> [text]",
+		Desc: "Prints the matches of the regular expression in text, one on each line.\n" +
+			"The text is read from the standard input if it is not given.",
+		Flags: []Flag{
+			{Name: "n", Value: -1, Arg: "count", Usage: "print at most count matches, or all of them if it is negative"},
+		},
+		Examples: []string{`r-find-all "[0-9]+" a1b22c333`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("r-find-all", argv)
+			if err != nil {
+				return err
+			}
+			n := flagInt(f, "n")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			re, err := cmd.Internal.compileRegexp(f.Arg(0))
+			if err != nil {
+				return err
+			}
+
+			s, err := subject(cmd, f.Args(), 1)
+			if err != nil {
+				return err
+			}
+
+			for _, v := range re.FindAllString(s, n) {
+				fmt.Fprintln(cmd.Stdout, v)
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("r-find-submatch", InternalCmd{
+		Synopsis: "r-find-submatch <regexp> [text]",
+		Desc: "Prints the first match of the regular expression in text and the matches of its groups, one on each line.\n" +
+			"The text is read from the standard input if it is not given.",
+		Examples: []string{`r-find-submatch {(\w+)@(\w+)} user@host`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			re, err := cmd.Internal.compileRegexp(argv[0])
+			if err != nil {
+				return err
+			}
+
+			s, err := subject(cmd, argv, 1)
+			if err != nil {
+				return err
+			}
+
+			for _, v := range re.FindStringSubmatch(s) {
+				fmt.Fprintln(cmd.Stdout, v)
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("r-replace", InternalCmd{
+		Synopsis: "r-replace [--literal] <regexp> <replacement> [text]",
+		Desc: "Replaces the matches of the regular expression in text.\n" +
+			"The text is read from the standard input if it is not given. In replacement, $1 or ${name} is replaced by the match of a group.",
+		Flags: []Flag{
+			{Name: "literal", Value: false, Usage: "use replacement as it is, without expanding $"},
+		},
+		Examples: []string{`r-replace {(\w+)@(\w+)} "$2:$1" user@host`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("r-replace", argv)
+			if err != nil {
+				return err
+			}
+			literal := flagBool(f, "literal")
+
+			if err := checkArgv(f.Args(), 2); err != nil {
+				return err
+			}
+
+			re, err := cmd.Internal.compileRegexp(f.Arg(0))
+			if err != nil {
+				return err
+			}
+
+			s, err := subject(cmd, f.Args(), 2)
+			if err != nil {
+				return err
+			}
+
+			if literal {
+				fmt.Fprintln(cmd.Stdout, re.ReplaceAllLiteralString(s, f.Arg(1)))
+				return nil
+			}
+
+			fmt.Fprintln(cmd.Stdout, re.ReplaceAllString(s, f.Arg(1)))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("r-split", InternalCmd{
+		Synopsis: "r-split [-n count] <regexp> [text]",
+		Desc: "Splits text around the matches of the regular expression and prints the parts, one on each line.\n" +
+			"The text is read from the standard input if it is not given.",
+		Flags: []Flag{
+			{Name: "n", Value: -1, Arg: "count", Usage: "split into at most count parts, or all of them if it is negative"},
+		},
+		Examples: []string{`r-split {\s*,\s*} "a, b ,c"`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("r-split", argv)
+			if err != nil {
+				return err
+			}
+			n := flagInt(f, "n")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			re, err := cmd.Internal.compileRegexp(f.Arg(0))
+			if err != nil {
+				return err
+			}
+
+			s, err := subject(cmd, f.Args(), 1)
+			if err != nil {
+				return err
+			}
+
+			for _, v := range re.Split(s, n) {
+				fmt.Fprintln(cmd.Stdout, v)
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("r-quote", InternalCmd{
+		Synopsis: "r-quote [text]",
+		Desc: "Prints text with the metacharacters of regular expressions escaped.\n" +
+			"The text is read from the standard input if it is not given.",
+		Examples: []string{"r-quote a.b*c"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			s, err := subject(cmd, argv, 0)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, regexp.QuoteMeta(s))
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("r-named-groups", InternalCmd{
+		Synopsis: "r-named-groups <regexp> [text]",
+		Desc: "Prints the matches of the named groups of the regular expression in the first match in text.\n" +
+			"The text is read from the standard input if it is not given.",
+		Examples: []string{`r-named-groups {(?P<user>\w+)@(?P<host>\w+)} user@host`},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			re, err := cmd.Internal.compileRegexp(argv[0])
+			if err != nil {
+				return err
+			}
+
+			s, err := subject(cmd, argv, 1)
+			if err != nil {
+				return err
+			}
+
+			m := re.FindStringSubmatch(s)
+			if m == nil {
+				return nil
+			}
+
+			for i, name := range re.SubexpNames() {
+				if name == "" {
+					continue
+				}
+				fmt.Fprintf(cmd.Stdout, "%v : %v\n", name, m[i])
+			}
+
+			return nil
+		},
+	})
+}
@@ -2,15 +2,37 @@ package lalash
 
 import (
 	"context"
-	"flag"
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
+var runeClasses = map[string]func(rune) bool{
+	"letter": unicode.IsLetter,
+	"digit":  unicode.IsDigit,
+	"space":  unicode.IsSpace,
+	"punct":  unicode.IsPunct,
+	"upper":  unicode.IsUpper,
+	"lower":  unicode.IsLower,
+}
+
+var runeMappers = map[string]func(rune) rune{
+	"upper": unicode.ToUpper,
+	"lower": unicode.ToLower,
+	"title": unicode.ToTitle,
+}
+
+var specialCases = map[string]unicode.SpecialCase{
+	"turkish": unicode.TurkishCase,
+	"azeri":   unicode.AzeriCase,
+}
+
 func (cmd Command) setInternalStringFamily() {
 	cmd.Internal.Cmds.Store("s-compare", InternalCmd{
-		Usage: "s-compare",
+		Synopsis: "s-compare <a> <b>",
+		Desc:     "Compares two strings and prints -1, 0 or 1 if a is less than, equal to or greater than b.",
+		Examples: []string{"s-compare a b"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -23,7 +45,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-contains", InternalCmd{
-		Usage: "s-contains",
+		Synopsis: "s-contains <s> <substr>",
+		Desc:     "Prints whether substr is in s.",
+		Examples: []string{"s-contains seafood foo"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -36,7 +60,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-contains-any", InternalCmd{
-		Usage: "s-contains-any",
+		Synopsis: "s-contains-any <s> <chars>",
+		Desc:     "Prints whether any of the characters in chars is in s.",
+		Examples: []string{"s-contains-any failure ui"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -49,7 +75,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-contains-rune", InternalCmd{
-		Usage: "s-contains-rune",
+		Synopsis: "s-contains-rune <s> <code>",
+		Desc:     "Prints whether the character of the code point, a decimal number, is in s.",
+		Examples: []string{"s-contains-rune abc 97"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -67,7 +95,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-count", InternalCmd{
-		Usage: "s-count",
+		Synopsis: "s-count <s> <substr>",
+		Desc:     "Prints the number of the occurrences of substr in s, which do not overlap.",
+		Examples: []string{"s-count cheese e"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -80,7 +110,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-equal-fold", InternalCmd{
-		Usage: "s-equal-fold",
+		Synopsis: "s-equal-fold <a> <b>",
+		Desc:     "Prints whether two strings are equal, ignoring case.",
+		Examples: []string{"s-equal-fold Go GO"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -93,7 +125,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-fields", InternalCmd{
-		Usage: "s-fields",
+		Synopsis: "s-fields <s>",
+		Desc:     "Splits s around runs of white space and prints the fields, one on each line.",
+		Examples: []string{`s-fields "  a b  c "`},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 1); err != nil {
 				return err
@@ -108,20 +142,36 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-fields-func", InternalCmd{
-		Usage: "s-has-prefix",
+		Synopsis: "s-fields-func <s> <predicate|{block}>",
+		Desc: "Splits s around runs of the characters which satisfy the predicate and prints the fields, one on each line.\n" +
+			`The predicate is one of letter, digit, space, punct, upper and lower, or a block which receives a character and prints "true" for it.`,
+		Examples: []string{
+			"s-fields-func a1b2c digit",
+			"s-fields-func a-b_c {s-contains-any (l-arg 0) -_}",
+		},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
 			}
 
-			fmt.Fprintln(cmd.Stdout, "unimplemented")
+			f, errp := runePredicate(ctx, cmd, argv[1])
+			res := strings.FieldsFunc(argv[0], f)
+			if *errp != nil {
+				return *errp
+			}
+
+			for _, v := range res {
+				fmt.Fprintln(cmd.Stdout, v)
+			}
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-has-prefix", InternalCmd{
-		Usage: "s-has-prefix",
+		Synopsis: "s-has-prefix <s> <prefix>",
+		Desc:     "Prints whether s begins with prefix.",
+		Examples: []string{"s-has-prefix golang go"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -134,7 +184,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-has-suffix", InternalCmd{
-		Usage: "s-has-suffix",
+		Synopsis: "s-has-suffix <s> <suffix>",
+		Desc:     "Prints whether s ends with suffix.",
+		Examples: []string{"s-has-suffix main.go .go"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -147,7 +199,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-index", InternalCmd{
-		Usage: "s-index",
+		Synopsis: "s-index <s> <substr>",
+		Desc:     "Prints the byte index of the first occurrence of substr in s, or -1.",
+		Examples: []string{"s-index chicken ken"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -160,7 +214,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-index-any", InternalCmd{
-		Usage: "s-index-any",
+		Synopsis: "s-index-any <s> <chars>",
+		Desc:     "Prints the byte index of the first occurrence of any of the characters in chars in s, or -1.",
+		Examples: []string{"s-index-any golang ny"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -173,7 +229,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-index-byte", InternalCmd{
-		Usage: "s-index-byte",
+		Synopsis: "s-index-byte <s> <byte>",
+		Desc:     "Prints the index of the first occurrence of a byte in s, or -1.",
+		Examples: []string{"s-index-byte golang g"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -190,16 +248,31 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-index-func", InternalCmd{
-		Usage: "s-index-func",
+		Synopsis: "s-index-func <s> <predicate|{block}>",
+		Desc: "Prints the byte index of the first character in s which satisfies the predicate, or -1.\n" +
+			`The predicate is one of letter, digit, space, punct, upper and lower, or a block which receives a character and prints "true" for it.`,
+		Examples: []string{"s-index-func abc1 digit"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			fmt.Fprintln(cmd.Stdout, "unimplemented")
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			f, errp := runePredicate(ctx, cmd, argv[1])
+			res := strings.IndexFunc(argv[0], f)
+			if *errp != nil {
+				return *errp
+			}
+
+			fmt.Fprintln(cmd.Stdout, res)
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-index-rune", InternalCmd{
-		Usage: "s-index-rune",
+		Synopsis: "s-index-rune <s> <code>",
+		Desc:     "Prints the byte index of the first occurrence of the character of the code point, a decimal number, in s, or -1.",
+		Examples: []string{"s-index-rune chicken 107"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -217,26 +290,33 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-join", InternalCmd{
-		Usage: "s-join",
+		Synopsis: "s-join [--sep sep] <elems...>",
+		Desc:     "Joins at least two strings and prints the result.",
+		Flags: []Flag{
+			{Name: "sep", Value: "", Arg: "sep", Usage: "put sep between the strings"},
+		},
+		Examples: []string{"s-join --sep , a b c"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			f := flag.NewFlagSet("join", flag.ContinueOnError)
-			sep := f.String("sep", "", "")
-			if err := f.Parse(argv); err != nil {
+			f, err := cmd.parseFlags("s-join", argv)
+			if err != nil {
 				return err
 			}
+			sep := flagString(f, "sep")
 
 			if err := checkArgv(f.Args(), 2); err != nil {
 				return err
 			}
 
-			fmt.Fprintln(cmd.Stdout, strings.Join(f.Args(), *sep))
+			fmt.Fprintln(cmd.Stdout, strings.Join(f.Args(), sep))
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-last-index", InternalCmd{
-		Usage: "s-last-index",
+		Synopsis: "s-last-index <s> <substr>",
+		Desc:     "Prints the byte index of the last occurrence of substr in s, or -1.",
+		Examples: []string{"s-last-index go_gopher go"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -249,7 +329,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-last-index-any", InternalCmd{
-		Usage: "s-last-index-any",
+		Synopsis: "s-last-index-any <s> <chars>",
+		Desc:     "Prints the byte index of the last occurrence of any of the characters in chars in s, or -1.",
+		Examples: []string{"s-last-index-any go_gopher go"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -262,7 +344,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-last-index-byte", InternalCmd{
-		Usage: "s-last-index-byte",
+		Synopsis: "s-last-index-byte <s> <byte>",
+		Desc:     "Prints the index of the last occurrence of a byte in s, or -1.",
+		Examples: []string{"s-last-index-byte go_gopher o"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -279,25 +363,55 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-last-index-func", InternalCmd{
-		Usage: "s-last-index-func",
+		Synopsis: "s-last-index-func <s> <predicate|{block}>",
+		Desc: "Prints the byte index of the last character in s which satisfies the predicate, or -1.\n" +
+			`The predicate is one of letter, digit, space, punct, upper and lower, or a block which receives a character and prints "true" for it.`,
+		Examples: []string{"s-last-index-func go123 letter"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			fmt.Fprintln(cmd.Stdout, "unimplemented")
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			f, errp := runePredicate(ctx, cmd, argv[1])
+			res := strings.LastIndexFunc(argv[0], f)
+			if *errp != nil {
+				return *errp
+			}
+
+			fmt.Fprintln(cmd.Stdout, res)
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-map", InternalCmd{
-		Usage: "s-map",
+		Synopsis: "s-map <mapping|{block}> <s>",
+		Desc: "Replaces each character of s and prints the result.\n" +
+			"The mapping is upper, lower or title, or a block which receives a character and prints its replacement.",
+		Examples: []string{
+			"s-map upper abc",
+			"s-map {s-repeat (l-arg 0) 2} abc",
+		},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			fmt.Fprintln(cmd.Stdout, "unimplemented")
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			res, err := mapRunes(ctx, cmd, argv[0], argv[1])
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, res)
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-repeat", InternalCmd{
-		Usage: "s-repeat",
+		Synopsis: "s-repeat <s> <count>",
+		Desc:     "Prints s repeated count times.",
+		Examples: []string{"s-repeat na 4"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -315,26 +429,33 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-replace", InternalCmd{
-		Usage: "s-replace",
+		Synopsis: "s-replace [-n count] <s> <old> <new>",
+		Desc:     "Replaces the occurrences of old in s with new and prints the result.",
+		Flags: []Flag{
+			{Name: "n", Value: -1, Arg: "count", Usage: "replace the first count occurrences, or all of them if it is negative"},
+		},
+		Examples: []string{"s-replace -n 2 oink oink oink k ky"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			f := flag.NewFlagSet("replace", flag.ContinueOnError)
-			n := f.Int("n", -1, "")
-			if err := f.Parse(argv); err != nil {
+			f, err := cmd.parseFlags("s-replace", argv)
+			if err != nil {
 				return err
 			}
+			n := flagInt(f, "n")
 
 			if err := checkArgv(f.Args(), 3); err != nil {
 				return err
 			}
 
-			fmt.Fprintln(cmd.Stdout, strings.Replace(f.Arg(0), f.Arg(1), f.Arg(2), *n))
+			fmt.Fprintln(cmd.Stdout, strings.Replace(f.Arg(0), f.Arg(1), f.Arg(2), n))
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-replace-all", InternalCmd{
-		Usage: "s-replace-all",
+		Synopsis: "s-replace-all <s> <old> <new>",
+		Desc:     "Replaces all the occurrences of old in s with new and prints the result.",
+		Examples: []string{`s-replace-all "oink oink" k ky`},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 3); err != nil {
 				return err
@@ -347,7 +468,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-split", InternalCmd{
-		Usage: "s-split",
+		Synopsis: "s-split <s> <sep>",
+		Desc:     "Splits s around sep and prints the parts, one on each line.",
+		Examples: []string{"s-split a,b,c ,"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -362,7 +485,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-split-after", InternalCmd{
-		Usage: "s-split-after",
+		Synopsis: "s-split-after <s> <sep>",
+		Desc:     "Splits s after each sep and prints the parts, one on each line.",
+		Examples: []string{"s-split-after a,b,c ,"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -377,19 +502,24 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-split-after-n", InternalCmd{
-		Usage: "s-split-after-n",
+		Synopsis: "s-split-after-n [-n count] <s> <sep>",
+		Desc:     "Splits s after each sep and prints the parts, one on each line.",
+		Flags: []Flag{
+			{Name: "n", Value: -1, Arg: "count", Usage: "split into at most count parts, or all of them if it is negative"},
+		},
+		Examples: []string{"s-split-after-n -n 2 a,b,c ,"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			f := flag.NewFlagSet("split after n", flag.ContinueOnError)
-			n := f.Int("n", -1, "")
-			if err := f.Parse(argv); err != nil {
+			f, err := cmd.parseFlags("s-split-after-n", argv)
+			if err != nil {
 				return err
 			}
+			n := flagInt(f, "n")
 
 			if err := checkArgv(f.Args(), 2); err != nil {
 				return err
 			}
 
-			for _, v := range strings.SplitAfterN(f.Arg(0), f.Arg(1), *n) {
+			for _, v := range strings.SplitAfterN(f.Arg(0), f.Arg(1), n) {
 				fmt.Fprintln(cmd.Stdout, v)
 			}
 
@@ -398,19 +528,24 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-split-n", InternalCmd{
-		Usage: "s-split-n",
+		Synopsis: "s-split-n [-n count] <s> <sep>",
+		Desc:     "Splits s around sep and prints the parts, one on each line.",
+		Flags: []Flag{
+			{Name: "n", Value: -1, Arg: "count", Usage: "split into at most count parts, or all of them if it is negative"},
+		},
+		Examples: []string{"s-split-n -n 2 a,b,c ,"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			f := flag.NewFlagSet("split n", flag.ContinueOnError)
-			n := f.Int("n", -1, "")
-			if err := f.Parse(argv); err != nil {
+			f, err := cmd.parseFlags("s-split-n", argv)
+			if err != nil {
 				return err
 			}
+			n := flagInt(f, "n")
 
 			if err := checkArgv(f.Args(), 2); err != nil {
 				return err
 			}
 
-			for _, v := range strings.SplitN(f.Arg(0), f.Arg(1), *n) {
+			for _, v := range strings.SplitN(f.Arg(0), f.Arg(1), n) {
 				fmt.Fprintln(cmd.Stdout, v)
 			}
 
@@ -419,7 +554,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-title", InternalCmd{
-		Usage: "s-title",
+		Synopsis: "s-title <s>",
+		Desc:     "Prints s with the first letter of each word in title case.",
+		Examples: []string{`s-title "hello world"`},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 1); err != nil {
 				return err
@@ -432,7 +569,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-to-lower", InternalCmd{
-		Usage: "s-to-lower",
+		Synopsis: "s-to-lower <s>",
+		Desc:     "Prints s in lower case.",
+		Examples: []string{"s-to-lower Gopher"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 1); err != nil {
 				return err
@@ -445,16 +584,30 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-to-lower-spechial", InternalCmd{
-		Usage: "s-to-lower-spechial",
+		Synopsis: "s-to-lower-spechial <case> <s>",
+		Desc: "Prints s in lower case, with the rules of a language.\n" +
+			"The case is turkish or azeri.",
+		Examples: []string{"s-to-lower-spechial turkish İSTANBUL"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			fmt.Fprintln(cmd.Stdout, "unimplemented")
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			c, err := specialCase(argv[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, strings.ToLowerSpecial(c, argv[1]))
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-to-title", InternalCmd{
-		Usage: "s-to-title",
+		Synopsis: "s-to-title <s>",
+		Desc:     "Prints s with all the letters in title case.",
+		Examples: []string{"s-to-title loud"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 1); err != nil {
 				return err
@@ -467,16 +620,30 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-to-title-spechial", InternalCmd{
-		Usage: "s-to-title-spechial",
+		Synopsis: "s-to-title-spechial <case> <s>",
+		Desc: "Prints s with all the letters in title case, with the rules of a language.\n" +
+			"The case is turkish or azeri.",
+		Examples: []string{"s-to-title-spechial turkish istanbul"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			fmt.Fprintln(cmd.Stdout, "unimplemented")
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			c, err := specialCase(argv[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, strings.ToTitleSpecial(c, argv[1]))
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-to-upper", InternalCmd{
-		Usage: "s-to-upper",
+		Synopsis: "s-to-upper <s>",
+		Desc:     "Prints s in upper case.",
+		Examples: []string{"s-to-upper Gopher"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 1); err != nil {
 				return err
@@ -489,16 +656,29 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-to-upper-spechial", InternalCmd{
-		Usage: "s-to-upper-spechial",
+		Synopsis: "s-to-upper-spechial <case> <s>",
+		Desc: "Prints s in upper case, with the rules of a language.\n" +
+			"The case is turkish or azeri.",
+		Examples: []string{"s-to-upper-spechial turkish istanbul"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			fmt.Fprintln(cmd.Stdout, "unimplemented")
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			c, err := specialCase(argv[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stdout, strings.ToUpperSpecial(c, argv[1]))
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-to-valid-utf8", InternalCmd{
-		Usage: "s-to-valid-utf8",
+		Synopsis: "s-to-valid-utf8 <s> <replacement>",
+		Desc:     "Replaces each run of invalid UTF-8 bytes in s with replacement and prints the result.",
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -511,7 +691,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-trim", InternalCmd{
-		Usage: "s-trim",
+		Synopsis: "s-trim <s> <chars>",
+		Desc:     "Removes the characters in chars from both ends of s and prints the result.",
+		Examples: []string{`s-trim "!!hi!!" !`},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -524,16 +706,31 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-trim-func", InternalCmd{
-		Usage: "s-trim-func",
+		Synopsis: "s-trim-func <s> <predicate|{block}>",
+		Desc: "Removes the characters which satisfy the predicate from both ends of s and prints the result.\n" +
+			`The predicate is one of letter, digit, space, punct, upper and lower, or a block which receives a character and prints "true" for it.`,
+		Examples: []string{"s-trim-func 123abc456 digit"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			fmt.Fprintln(cmd.Stdout, "unimplemented")
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			f, errp := runePredicate(ctx, cmd, argv[1])
+			res := strings.TrimFunc(argv[0], f)
+			if *errp != nil {
+				return *errp
+			}
+
+			fmt.Fprintln(cmd.Stdout, res)
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-trim-left", InternalCmd{
-		Usage: "s-trim-left",
+		Synopsis: "s-trim-left <s> <chars>",
+		Desc:     "Removes the characters in chars from the beginning of s and prints the result.",
+		Examples: []string{`s-trim-left "!!hi!!" !`},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -546,16 +743,31 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-trim-left-func", InternalCmd{
-		Usage: "s-trim-left-func",
+		Synopsis: "s-trim-left-func <s> <predicate|{block}>",
+		Desc: "Removes the characters which satisfy the predicate from the beginning of s and prints the result.\n" +
+			`The predicate is one of letter, digit, space, punct, upper and lower, or a block which receives a character and prints "true" for it.`,
+		Examples: []string{"s-trim-left-func 123abc digit"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			fmt.Fprintln(cmd.Stdout, "unimplemented")
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			f, errp := runePredicate(ctx, cmd, argv[1])
+			res := strings.TrimLeftFunc(argv[0], f)
+			if *errp != nil {
+				return *errp
+			}
+
+			fmt.Fprintln(cmd.Stdout, res)
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-trim-prefix", InternalCmd{
-		Usage: "s-trim-prefix",
+		Synopsis: "s-trim-prefix <s> <prefix>",
+		Desc:     "Removes prefix from the beginning of s, if s begins with it, and prints the result.",
+		Examples: []string{"s-trim-prefix v1.2 v"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -568,7 +780,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-trim-right", InternalCmd{
-		Usage: "s-trim-right",
+		Synopsis: "s-trim-right <s> <chars>",
+		Desc:     "Removes the characters in chars from the end of s and prints the result.",
+		Examples: []string{`s-trim-right "!!hi!!" !`},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -581,16 +795,31 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-trim-right-func", InternalCmd{
-		Usage: "s-trim-right-func",
+		Synopsis: "s-trim-right-func <s> <predicate|{block}>",
+		Desc: "Removes the characters which satisfy the predicate from the end of s and prints the result.\n" +
+			`The predicate is one of letter, digit, space, punct, upper and lower, or a block which receives a character and prints "true" for it.`,
+		Examples: []string{"s-trim-right-func abc123 digit"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
-			fmt.Fprintln(cmd.Stdout, "unimplemented")
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			f, errp := runePredicate(ctx, cmd, argv[1])
+			res := strings.TrimRightFunc(argv[0], f)
+			if *errp != nil {
+				return *errp
+			}
+
+			fmt.Fprintln(cmd.Stdout, res)
 
 			return nil
 		},
 	})
 
 	cmd.Internal.Cmds.Store("s-trim-space", InternalCmd{
-		Usage: "s-trim-space",
+		Synopsis: "s-trim-space <s>",
+		Desc:     "Removes white space from both ends of s and prints the result.",
+		Examples: []string{`s-trim-space "  a b  "`},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 1); err != nil {
 				return err
@@ -603,7 +832,9 @@ func (cmd Command) setInternalStringFamily() {
 	})
 
 	cmd.Internal.Cmds.Store("s-trim-suffix", InternalCmd{
-		Usage: "s-trim-suffix",
+		Synopsis: "s-trim-suffix <s> <suffix>",
+		Desc:     "Removes suffix from the end of s, if s ends with it, and prints the result.",
+		Examples: []string{"s-trim-suffix main.go .go"},
 		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
 			if err := checkArgv(argv, 2); err != nil {
 				return err
@@ -615,3 +846,62 @@ func (cmd Command) setInternalStringFamily() {
 		},
 	})
 }
+
+func specialCase(name string) (unicode.SpecialCase, error) {
+	c, ok := specialCases[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown special case: %v", name)
+	}
+	return c, nil
+}
+
+// runePredicate returns a predicate for the strings *Func helpers. fn is
+// either one of runeClasses or a function or block which is called per rune
+// and reports true by printing "true". Since the helpers cannot be aborted,
+// the first error is stored in the returned pointer and the remaining runes
+// are skipped.
+func runePredicate(ctx context.Context, cmd Command, fn string) (func(rune) bool, *error) {
+	var err error
+
+	if f, ok := runeClasses[fn]; ok {
+		return f, &err
+	}
+
+	return func(r rune) bool {
+		if err != nil {
+			return false
+		}
+
+		if err = ctx.Err(); err != nil {
+			return false
+		}
+
+		var res string
+		res, err = callFuncOutput(ctx, cmd, fn, string(r))
+		return err == nil && strings.TrimSpace(res) == "true"
+	}, &err
+}
+
+// mapRunes replaces each rune of s with the output of fn. An empty output
+// drops the rune.
+func mapRunes(ctx context.Context, cmd Command, fn, s string) (string, error) {
+	if f, ok := runeMappers[fn]; ok {
+		return strings.Map(f, s), nil
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		res, err := callFuncOutput(ctx, cmd, fn, string(r))
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(res)
+	}
+
+	return b.String(), nil
+}
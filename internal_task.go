@@ -0,0 +1,589 @@
+package lalash
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDoneTasks is the number of finished tasks kept until they are awaited.
+// Past it, the oldest ones are dropped.
+const maxDoneTasks = 64
+
+// task is a block evaluated concurrently by l-go. It is cancelled with the
+// scope which started it; the tasks of the shell run until it exits.
+type task struct {
+	done chan struct{}
+	out  bytes.Buffer
+	err  error
+}
+
+// channel is a channel of strings created by l-chan. It is closed by closing
+// done, so that sending on a closed channel fails instead of panicking.
+type channel struct {
+	c    chan string
+	done chan struct{}
+}
+
+func (i Internal) getTask(id string) (int, *task, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid task id: %v", id)
+	}
+
+	v, ok := i.Tasks.Load(n)
+	if !ok {
+		return 0, nil, fmt.Errorf("no such task: %v", id)
+	}
+
+	return n, v.(*task), nil
+}
+
+// dropDoneTasks drops the oldest finished tasks, so that fewer than
+// maxDoneTasks of them are kept.
+func (i Internal) dropDoneTasks() {
+	done := []int{}
+	i.Tasks.Range(func(key, value interface{}) bool {
+		select {
+		case <-value.(*task).done:
+			done = append(done, key.(int))
+		default:
+		}
+		return true
+	})
+
+	if len(done) < maxDoneTasks {
+		return
+	}
+
+	sort.Ints(done)
+	for _, id := range done[:len(done)-maxDoneTasks+1] {
+		i.Tasks.Delete(id)
+	}
+}
+
+func (i Internal) getChan(name string) (*channel, error) {
+	v, ok := i.Chans.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("no such channel: %v", name)
+	}
+	return v.(*channel), nil
+}
+
+func (ch *channel) send(ctx context.Context, v string) error {
+	select {
+	case <-ch.done:
+		return fmt.Errorf("send on closed channel")
+	default:
+	}
+
+	select {
+	case ch.c <- v:
+		return nil
+	case <-ch.done:
+		return fmt.Errorf("send on closed channel")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recv receives a value from ch. ok is false if ch is closed and empty.
+func (ch *channel) recv(ctx context.Context) (v string, ok bool, err error) {
+	select {
+	case v := <-ch.c:
+		return v, true, nil
+	case <-ch.done:
+		select {
+		case v := <-ch.c:
+			return v, true, nil
+		default:
+			return "", false, nil
+		}
+	case <-ctx.Done():
+		return "", false, ctx.Err()
+	}
+}
+
+// taskCmd returns the command in which a task is evaluated. Tasks cannot read
+// the input of the shell nor take the terminal, and leave signals to it.
+func taskCmd(cmd Command) Command {
+	c := cmd
+	c.Stdin = strings.NewReader("")
+	c.tty = nil
+	c.signals = nil
+	c.wd = cmd.wd.clone()
+	return c
+}
+
+// parallel evaluates fn for each item with at most n in flight, and writes
+// the output of the items in their order. Unless failFast is set, every item
+// is evaluated and the failed ones are reported at the end.
+func parallel(ctx context.Context, cmd Command, fn string, items []string, n int, failFast bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		done   chan struct{}
+		stdout bytes.Buffer
+		stderr bytes.Buffer
+		err    error
+	}
+
+	// With failFast, the first item to fail cancels the others.
+	var mu sync.Mutex
+	failedAt := -1
+
+	results := make([]*result, len(items))
+	for i := range results {
+		results[i] = &result{done: make(chan struct{})}
+	}
+
+	go func() {
+		sem := make(chan struct{}, n)
+		for i := range items {
+			r := results[i]
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				r.err = ctx.Err()
+				close(r.done)
+				continue
+			}
+
+			c := taskCmd(cmd)
+			c.Stdout = &r.stdout
+			c.Stderr = &r.stderr
+
+			go func(i int) {
+				defer func() { <-sem }()
+				defer close(r.done)
+
+				r.err = callFunc(ctx, c, fn, items[i])
+				if r.err != nil && failFast {
+					mu.Lock()
+					if failedAt < 0 {
+						failedAt = i
+						cancel()
+					}
+					mu.Unlock()
+				}
+			}(i)
+		}
+	}()
+
+	failed := 0
+	for i, r := range results {
+		<-r.done
+
+		if _, err := cmd.Stdout.Write(r.stdout.Bytes()); err != nil {
+			return err
+		}
+		if _, err := cmd.Stderr.Write(r.stderr.Bytes()); err != nil {
+			return err
+		}
+
+		if r.err == nil {
+			continue
+		}
+
+		if !failFast {
+			failed++
+			fmt.Fprintln(cmd.Stderr, items[i], ":", r.err)
+		}
+	}
+
+	if failedAt >= 0 {
+		return fmt.Errorf("%v: %v", items[failedAt], results[failedAt].err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d items failed", failed, len(items))
+	}
+
+	return nil
+}
+
+func (cmd Command) setInternalTaskFamily() {
+	cmd.Internal.Cmds.Store("l-go", InternalCmd{
+		Synopsis: "l-go {block} [args...]",
+		Desc: "Starts the block in the background and prints the ID of the task.\n" +
+			"The output of the block is kept until the task is awaited with l-await. The task is cancelled when the function which started it returns, and only the latest finished tasks are kept.",
+		Examples: []string{"l-await (l-go {l-echo done})"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			t := &task{
+				done: make(chan struct{}),
+			}
+
+			c := taskCmd(cmd)
+			c.Stdout = &t.out
+
+			// Tasks outlive the line which starts them, so that they can be
+			// awaited from the next one.
+			scope := cmd.scope
+			if scope == nil {
+				scope = context.Background()
+			}
+
+			cmd.Internal.dropDoneTasks()
+
+			id := 1
+			for ; ; id++ {
+				if _, loaded := cmd.Internal.Tasks.LoadOrStore(id, t); !loaded {
+					break
+				}
+			}
+
+			go func() {
+				defer close(t.done)
+				t.err = callFunc(scope, c, argv[0], argv[1:]...)
+			}()
+
+			fmt.Fprintln(cmd.Stdout, id)
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-await", InternalCmd{
+		Synopsis: "l-await <ids...>",
+		Desc: "Waits for the tasks started with l-go, and prints their output.\n" +
+			"The error of a failed task is returned.",
+		Examples: []string{"l-var t (l-go {l-echo done}); l-await (l-var --ref t)"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 1); err != nil {
+				return err
+			}
+
+			for _, v := range argv {
+				id, t, err := cmd.Internal.getTask(v)
+				if err != nil {
+					return err
+				}
+
+				select {
+				case <-t.done:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+
+				cmd.Internal.Tasks.Delete(id)
+
+				if _, err := cmd.Stdout.Write(t.out.Bytes()); err != nil {
+					return err
+				}
+				if t.err != nil {
+					return fmt.Errorf("task %d: %v", id, t.err)
+				}
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-parallel", InternalCmd{
+		Synopsis: "l-parallel [-j n] [--fail-fast] {block} [items...]",
+		Desc: "Calls the block with each item, running at most n of them at once.\n" +
+			"The items are read from the lines of the standard input if none are given. The output of each call is printed in the order of the items.",
+		Flags: []Flag{
+			{Name: "j", Value: runtime.NumCPU(), Arg: "n", Usage: "run at most n blocks at once"},
+			{Name: "fail-fast", Value: false, Usage: "stop starting blocks after one of them fails"},
+		},
+		Examples: []string{"l-parallel -j 2 {l-echo (l-arg 0)} a b c"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-parallel", argv)
+			if err != nil {
+				return err
+			}
+			j := flagInt(f, "j")
+			failFast := flagBool(f, "fail-fast")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			if j < 1 {
+				return fmt.Errorf("invalid number of jobs: %d", j)
+			}
+
+			items := f.Args()[1:]
+			if len(items) == 0 {
+				s := bufio.NewScanner(cmd.Stdin)
+				for s.Scan() {
+					if s.Text() != "" {
+						items = append(items, s.Text())
+					}
+				}
+				if err := s.Err(); err != nil {
+					return err
+				}
+			}
+
+			return parallel(ctx, cmd, f.Arg(0), items, j, failFast)
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-timeout", InternalCmd{
+		Synopsis: "l-timeout <duration> {block} [args...]",
+		Desc: "Calls the block, and cancels it if it does not finish within the duration.\n" +
+			`The duration is written as "1.5s" or "2m".`,
+		Examples: []string{"l-timeout 1s {sleep 10}"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			d, err := time.ParseDuration(argv[0])
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			err = callFunc(ctx, cmd, argv[1], argv[2:]...)
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("timed out after %v", d)
+			}
+
+			return err
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-retry", InternalCmd{
+		Synopsis: "l-retry [-n attempts] [--delay duration] [--backoff const|exp] {block} [args...]",
+		Desc: "Calls the block until it succeeds, at most the given number of times.\n" +
+			"The failures before the last one are reported on the standard error.",
+		Flags: []Flag{
+			{Name: "n", Value: 3, Arg: "attempts", Usage: "call the block at most attempts times"},
+			{Name: "delay", Value: time.Second, Usage: "wait for duration between the attempts"},
+			{Name: "backoff", Value: "const", Arg: "const|exp", Usage: "keep the delay, or double it after each attempt"},
+		},
+		Examples: []string{"l-retry -n 5 --delay 100ms --backoff exp {curl -fs localhost:8080}"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-retry", argv)
+			if err != nil {
+				return err
+			}
+			n := flagInt(f, "n")
+			delay := flagDuration(f, "delay")
+			backoff := flagString(f, "backoff")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			if n < 1 {
+				return fmt.Errorf("invalid number of attempts: %d", n)
+			}
+
+			if backoff != "const" && backoff != "exp" {
+				return fmt.Errorf("invalid backoff: %v", backoff)
+			}
+
+			d := delay
+			for i := 1; ; i++ {
+				err := callFunc(ctx, cmd, f.Arg(0), f.Args()[1:]...)
+				if err == nil {
+					return nil
+				}
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if i == n {
+					return fmt.Errorf("failed after %d attempts: %v", i, err)
+				}
+
+				fmt.Fprintf(cmd.Stderr, "attempt %d failed: %v\n", i, err)
+
+				select {
+				case <-time.After(d):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+
+				if backoff == "exp" {
+					d *= 2
+				}
+			}
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-chan", InternalCmd{
+		Synopsis: "l-chan create [-n size] <name> | send <name> <value> | recv <name> | close <name>",
+		Desc: "Creates a channel, sends a value to it, receives a value from it and prints it, or closes it.\n" +
+			"Receiving from a closed channel which is empty fails.",
+		Flags: []Flag{
+			{Name: "n", Value: 0, Arg: "size", Usage: "buffer size values in the channel created"},
+		},
+		Examples: []string{"l-chan create -n 1 c; l-chan send c hello; l-chan recv c"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if err := checkArgv(argv, 2); err != nil {
+				return err
+			}
+
+			switch argv[0] {
+			case "create":
+				f, err := cmd.parseFlags("l-chan", argv[1:])
+				if err != nil {
+					return err
+				}
+				n := flagInt(f, "n")
+
+				if err := checkArgv(f.Args(), 1); err != nil {
+					return err
+				}
+
+				if n < 0 {
+					return fmt.Errorf("invalid size: %d", n)
+				}
+
+				cmd.Internal.Chans.Store(f.Arg(0), &channel{
+					c:    make(chan string, n),
+					done: make(chan struct{}),
+				})
+
+				return nil
+
+			case "send":
+				if err := checkArgv(argv, 3); err != nil {
+					return err
+				}
+
+				ch, err := cmd.Internal.getChan(argv[1])
+				if err != nil {
+					return err
+				}
+
+				return ch.send(ctx, argv[2])
+
+			case "recv":
+				ch, err := cmd.Internal.getChan(argv[1])
+				if err != nil {
+					return err
+				}
+
+				v, ok, err := ch.recv(ctx)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("channel closed: %v", argv[1])
+				}
+
+				fmt.Fprintln(cmd.Stdout, v)
+
+				return nil
+
+			case "close":
+				ch, err := cmd.Internal.getChan(argv[1])
+				if err != nil {
+					return err
+				}
+
+				select {
+				case <-ch.done:
+					return fmt.Errorf("channel already closed: %v", argv[1])
+				default:
+					close(ch.done)
+				}
+
+				return nil
+			}
+
+			return fmt.Errorf("invalid subcommand: %v", argv[0])
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-select", InternalCmd{
+		Synopsis: "l-select [--default {block}] <name> {block} [<name> {block}...]",
+		Desc: "Waits for a value from one of the channels, and calls its block with the value.\n" +
+			"The default block is called if no value is ready. It fails when all the channels are closed.",
+		Flags: []Flag{
+			{Name: "default", Value: "", Arg: "{block}", Usage: "call block instead of waiting"},
+		},
+		Examples: []string{"l-select a {l-echo a: (l-arg 0)} b {l-echo b: (l-arg 0)}"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-select", argv)
+			if err != nil {
+				return err
+			}
+			deflt := flagString(f, "default")
+
+			argv = f.Args()
+			if len(argv) == 0 || len(argv)%2 != 0 {
+				return fmt.Errorf("pairs of a channel and a block are required")
+			}
+
+			names := []string{}
+			blocks := []string{}
+			chans := []*channel{}
+			for i := 0; i < len(argv); i += 2 {
+				ch, err := cmd.Internal.getChan(argv[i])
+				if err != nil {
+					return err
+				}
+				names = append(names, argv[i])
+				blocks = append(blocks, argv[i+1])
+				chans = append(chans, ch)
+			}
+
+			// Each channel has a case for a value and one for being closed,
+			// followed by the cases of ctx and the default block.
+			cases := []reflect.SelectCase{}
+			for _, ch := range chans {
+				cases = append(cases,
+					reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.c)},
+					reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.done)},
+				)
+			}
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+			if deflt != "" {
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+			}
+
+			open := len(chans)
+			for open > 0 {
+				i, v, _ := reflect.Select(cases)
+
+				switch {
+				case i == 2*len(chans):
+					return ctx.Err()
+
+				case i > 2*len(chans):
+					return callFunc(ctx, cmd, deflt)
+
+				case i%2 == 0:
+					return callFunc(ctx, cmd, blocks[i/2], v.String())
+
+				default:
+					// The channel is closed; take what is left in it, or
+					// stop waiting for it.
+					ch := chans[i/2]
+					select {
+					case v := <-ch.c:
+						return callFunc(ctx, cmd, blocks[i/2], v)
+					default:
+					}
+					cases[i-1].Chan = reflect.Value{}
+					cases[i].Chan = reflect.Value{}
+					open--
+				}
+			}
+
+			return fmt.Errorf("all channels closed: %v", strings.Join(names, " "))
+		},
+	})
+}
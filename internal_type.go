@@ -0,0 +1,244 @@
+package lalash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// lookPathAll returns the executables which name may run, in the order they
+// are looked up. A name with "/" is a path, and the others are searched in the
+// directories of PATH.
+func (cmd Command) lookPathAll(name string) []string {
+	if strings.ContainsRune(name, '/') {
+		p, err := cmd.absPath(name)
+		if err != nil {
+			return nil
+		}
+		if p, err := exec.LookPath(p); err == nil {
+			return []string{p}
+		}
+		return nil
+	}
+
+	paths := []string{}
+	seen := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		p, err := exec.LookPath(filepath.Join(dir, name))
+		if err != nil || seen[p] {
+			continue
+		}
+		seen[p] = true
+		paths = append(paths, p)
+	}
+
+	return paths
+}
+
+// describeAlias describes the alias or function name, whose value is v. A
+// function is followed by its definition.
+func (cmd Command) describeAlias(name, v string) string {
+	if !isFunc(v) {
+		return fmt.Sprintf("%v is an alias for {%v}", name, v)
+	}
+
+	in := cmd.Internal
+	fn := name
+	s := name + " is a function"
+	if path, f, ok := moduleFunc(v); ok {
+		m, ok := cmd.Internal.Modules.Load(path)
+		if !ok {
+			return fmt.Sprintf("%v is a function of the module %v", name, cmd.relPath(path))
+		}
+		in = m.(*module).internal
+		fn = f
+		s = fmt.Sprintf("%v is the function %v of the module %v", name, fn, strings.TrimSuffix(name, "."+fn))
+		body, _ := in.Alias.Load(fn)
+		v, _ = body.(string)
+	}
+
+	if pos, ok := in.FuncPos.Load(fn); ok {
+		pos := pos.(sourcePos)
+		s += fmt.Sprintf(" defined at %v:%d", cmd.relPath(pos.file), pos.line)
+	}
+
+	if !strings.HasPrefix(v, "l-eval ") {
+		return s
+	}
+	return s + "\nl-fn " + fn + " " + strings.TrimPrefix(v, "l-eval ")
+}
+
+// describeBuiltin describes the internal command name.
+func (cmd Command) describeBuiltin(name string) string {
+	return fmt.Sprintf("%v is a builtin of the %v family", name, family(name))
+}
+
+// candidate is a command which a name may run.
+type candidate struct {
+	kind string // one of the types of commandType
+	desc string
+	path string // the path of an external executable
+}
+
+// resolve returns the commands which name may run, in the order they are
+// looked up, so that the first one is what runs.
+func (cmd Command) resolve(name string) []candidate {
+	res := []candidate{}
+
+	if v, ok := cmd.Internal.Alias.Load(name); ok {
+		kind := cmdTypeAlias
+		if isFunc(v.(string)) {
+			kind = cmdTypeFunction
+		}
+		res = append(res, candidate{kind: kind, desc: cmd.describeAlias(name, v.(string))})
+	}
+
+	if _, ok := cmd.Internal.Cmds.Load(name); ok {
+		res = append(res, candidate{kind: cmdTypeBuiltin, desc: cmd.describeBuiltin(name)})
+	}
+
+	for _, p := range cmd.lookPathAll(name) {
+		res = append(res, candidate{kind: cmdTypeFile, desc: fmt.Sprintf("%v is %v", name, p), path: p})
+	}
+
+	return res
+}
+
+// typeOf describes what runs when name is run as a command. An alias is
+// followed by the commands it expands to.
+func (cmd Command) typeOf(name string) (string, error) {
+	chain, err := cmd.Internal.aliasChain(name)
+	if err != nil {
+		return "", err
+	}
+
+	if len(chain) == 0 {
+		res := cmd.resolve(name)
+		if len(res) == 0 {
+			return "", fmt.Errorf("not found: %v", name)
+		}
+		return res[0].desc, nil
+	}
+
+	lines := []string{}
+	for _, v := range chain {
+		alias, _ := cmd.Internal.Alias.Load(v)
+		lines = append(lines, cmd.describeAlias(v, alias.(string)))
+	}
+
+	last, _ := cmd.Internal.Alias.Load(chain[len(chain)-1])
+	if next := firstWord(last.(string)); next != "" && !isFunc(last.(string)) {
+		if res := cmd.resolve(next); len(res) > 0 {
+			lines = append(lines, res[0].desc)
+		} else {
+			lines = append(lines, next+" is not found")
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func (cmd Command) setInternalTypeFamily() {
+	cmd.Internal.Cmds.Store("l-type", InternalCmd{
+		Synopsis: "l-type [-t] <names...>",
+		Desc: "Shows how each name runs as a command: as an alias, a function, a builtin or an external executable.\n" +
+			"An alias is followed by the commands it expands to, a function by its definition and where it was defined, and an executable by its path.",
+		Flags: []Flag{
+			{Name: "t", Value: false, Usage: "print only the type: alias, function, builtin or file"},
+		},
+		Examples: []string{
+			"l-type l-echo ls",
+			"l-alias ll {ls -l}; l-type ll",
+			"l-type -t l-echo",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-type", argv)
+			if err != nil {
+				return err
+			}
+			onlyType := flagBool(f, "t")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			for _, name := range f.Args() {
+				if onlyType {
+					if _, err := cmd.Internal.aliasChain(name); err != nil {
+						return err
+					}
+					res := cmd.resolve(name)
+					if len(res) == 0 {
+						return fmt.Errorf("not found: %v", name)
+					}
+					fmt.Fprintln(cmd.Stdout, res[0].kind)
+					continue
+				}
+
+				s, err := cmd.typeOf(name)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.Stdout, s)
+			}
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-which", InternalCmd{
+		Synopsis: "l-which [-a] <names...>",
+		Desc: "Prints the command which each name runs, or the path of an external executable.\n" +
+			"With -a, every command of the name is printed in the order they are looked up: an alias or a function, a builtin, and the executables in PATH.",
+		Flags: []Flag{
+			{Name: "a", Value: false, Usage: "print all the commands of the name"},
+		},
+		Examples: []string{
+			"l-which git",
+			"l-which -a ls",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-which", argv)
+			if err != nil {
+				return err
+			}
+			all := flagBool(f, "a")
+
+			if err := checkArgv(f.Args(), 1); err != nil {
+				return err
+			}
+
+			notFound := []string{}
+			for _, name := range f.Args() {
+				res := cmd.resolve(name)
+				if len(res) == 0 {
+					notFound = append(notFound, name)
+					continue
+				}
+				if !all {
+					res = res[:1]
+				}
+
+				for _, v := range res {
+					if v.kind == cmdTypeFile {
+						fmt.Fprintln(cmd.Stdout, v.path)
+						continue
+					}
+					fmt.Fprintln(cmd.Stdout, v.desc)
+				}
+			}
+
+			if len(notFound) > 0 {
+				return fmt.Errorf("not found: %v", strings.Join(notFound, " "))
+			}
+
+			return nil
+		},
+	})
+}
@@ -0,0 +1,413 @@
+package lalash
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/w-haibara/lalash/parser"
+)
+
+const (
+	jobRunning = "running"
+	jobStopped = "stopped"
+	jobDone    = "done"
+)
+
+// Job is a command line started in the background with "&", or a foreground
+// command which has been stopped.
+type Job struct {
+	ID      int
+	Cmdline string
+
+	mu       sync.Mutex
+	pid      int // process group of the running external command, 0 if none
+	state    string
+	err      error
+	fg       bool
+	changed  chan struct{}
+	notified bool
+}
+
+func (j *Job) update(f func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f()
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+func (j *Job) setProcess(pid int) {
+	j.update(func() {
+		j.pid = pid
+	})
+}
+
+func (j *Job) setState(state string) {
+	j.update(func() {
+		j.state = state
+	})
+}
+
+func (j *Job) finish(err error) {
+	j.update(func() {
+		j.pid = 0
+		j.state = jobDone
+		j.err = err
+	})
+}
+
+func (j *Job) snapshot() (pid int, state string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.pid, j.state, j.err
+}
+
+// markNotified marks that the end of j has been reported, and tells whether
+// it had not been yet.
+func (j *Job) markNotified() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	first := !j.notified
+	j.notified = true
+	return first
+}
+
+func (j *Job) status() string {
+	_, state, err := j.snapshot()
+	if state == jobDone && err != nil {
+		return fmt.Sprintf("failed (%v)", err)
+	}
+	return state
+}
+
+// wait blocks until the job is done, or also until it is stopped when
+// stopped is set.
+func (j *Job) wait(ctx context.Context, stopped bool) error {
+	for {
+		j.mu.Lock()
+		state, changed := j.state, j.changed
+		j.mu.Unlock()
+
+		if state == jobDone || (stopped && state == jobStopped) {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func newJob(cmdline string) *Job {
+	return &Job{
+		Cmdline: cmdline,
+		state:   jobRunning,
+		changed: make(chan struct{}),
+	}
+}
+
+// addJob registers j under the smallest free ID.
+func (i Internal) addJob(j *Job) {
+	for id := 1; ; id++ {
+		j.ID = id
+		if _, loaded := i.Jobs.LoadOrStore(id, j); !loaded {
+			return
+		}
+	}
+}
+
+func (i Internal) jobsAll() []*Job {
+	jobs := []*Job{}
+	i.Jobs.Range(func(key, value interface{}) bool {
+		if j, ok := value.(*Job); ok {
+			jobs = append(jobs, j)
+		}
+		return true
+	})
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].ID < jobs[b].ID
+	})
+	return jobs
+}
+
+// getJob returns the job of the given ID, or the most recent one if id is
+// blank. A leading "%" is allowed as in other shells.
+func (i Internal) getJob(id string) (*Job, error) {
+	if id == "" {
+		jobs := i.jobsAll()
+		if len(jobs) == 0 {
+			return nil, fmt.Errorf("no current job")
+		}
+		return jobs[len(jobs)-1], nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(id, "%"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid job id: %v", id)
+	}
+
+	v, ok := i.Jobs.Load(n)
+	if !ok {
+		return nil, fmt.Errorf("no such job: %v", id)
+	}
+
+	return v.(*Job), nil
+}
+
+// notifyJobs reports jobs which have finished since the last call and
+// removes them from the job table.
+func (i Internal) notifyJobs(w io.Writer) {
+	for _, j := range i.jobsAll() {
+		if _, state, _ := j.snapshot(); state != jobDone {
+			continue
+		}
+		if j.markNotified() {
+			fmt.Fprintf(w, "[%d] %v %v\n", j.ID, j.status(), j.Cmdline)
+		}
+		i.Jobs.Delete(j.ID)
+	}
+}
+
+func tokensString(tokens []parser.Token) string {
+	s := []string{}
+	for _, v := range tokens {
+		switch v.Kind {
+		case parser.StringToken:
+			s = append(s, "\""+v.Val+"\"")
+		case parser.RawStringToken:
+			s = append(s, "{"+v.Val+"}")
+		case parser.SubstitutionToken:
+			s = append(s, "("+v.Val+")")
+		default:
+			s = append(s, v.Val)
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+// startJob evaluates tokens in the background. The job does not inherit ctx,
+// which ends with the command line that started it.
+func startJob(ctx context.Context, cmd Command, tokens []parser.Token) error {
+	if len(tokens) == 0 || tokens[0].Val == "" {
+		return nil
+	}
+
+	j := newJob(tokensString(tokens))
+	cmd.Internal.addJob(j)
+
+	c := cmd
+	c.job = j
+	c.wd = cmd.wd.clone()
+	if cmd.tty == nil {
+		// Without job control, background jobs cannot read the input of
+		// the shell.
+		c.Stdin = strings.NewReader("")
+	}
+
+	go func() {
+		j.finish(eval(context.Background(), c, tokens))
+	}()
+
+	if cmd.tty != nil {
+		fmt.Fprintf(cmd.Stderr, "[%d] %v\n", j.ID, j.Cmdline)
+	}
+
+	return nil
+}
+
+// foreground waits for j in the foreground, handing the terminal to it.
+func foreground(ctx context.Context, cmd Command, j *Job) error {
+	j.update(func() {
+		j.fg = true
+	})
+	defer j.update(func() {
+		j.fg = false
+	})
+
+	pid, state, _ := j.snapshot()
+	if pid != 0 {
+		if cmd.tty != nil {
+			if err := setForeground(cmd.tty, pid); err != nil {
+				return err
+			}
+			defer setForeground(cmd.tty, 0)
+		}
+
+		if state == jobStopped {
+			if err := continueProcessGroup(pid); err != nil {
+				return err
+			}
+			j.setState(jobRunning)
+		}
+	}
+
+	if err := j.wait(ctx, true); err != nil {
+		return err
+	}
+
+	_, state, err := j.snapshot()
+	if state == jobStopped {
+		fmt.Fprintf(cmd.Stderr, "[%d] %v %v\n", j.ID, state, j.Cmdline)
+		return nil
+	}
+
+	j.markNotified()
+	cmd.Internal.Jobs.Delete(j.ID)
+
+	return err
+}
+
+// runForeground runs c in the foreground of the terminal. When it is stopped,
+// it is turned into a job and the shell takes the terminal back, so c must not
+// be bound to ctx, which ends with the command line. Until then, cancelling ctx
+// kills it.
+func runForeground(ctx context.Context, cmd Command, c *exec.Cmd, cmdline string) error {
+	j := newJob(cmdline)
+	j.fg = true
+
+	go func() {
+		j.finish(j.run(c, cmd.tty))
+	}()
+	if cmd.tty != nil {
+		defer setForeground(cmd.tty, 0)
+	}
+
+	if err := j.wait(ctx, true); err != nil {
+		if pid, _, _ := j.snapshot(); pid != 0 {
+			killProcessGroup(pid)
+		}
+		j.wait(context.Background(), false)
+		return err
+	}
+
+	_, state, err := j.snapshot()
+	if state == jobStopped {
+		j.update(func() {
+			j.fg = false
+		})
+		cmd.Internal.addJob(j)
+		fmt.Fprintf(cmd.Stderr, "\n[%d] %v %v\n", j.ID, state, j.Cmdline)
+		return nil
+	}
+
+	return err
+}
+
+func (cmd Command) setInternalJobFamily() {
+	cmd.Internal.Cmds.Store("l-jobs", InternalCmd{
+		Synopsis: "l-jobs",
+		Desc: "Lists the jobs with their IDs, process IDs and states.\n" +
+			`A job is a command line started in the background with "&", or a command stopped with Ctrl-Z.`,
+		Examples: []string{"sleep 10 &; l-jobs"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			for _, j := range cmd.Internal.jobsAll() {
+				pid, _, _ := j.snapshot()
+				fmt.Fprintf(cmd.Stdout, "[%d] %d %v %v\n", j.ID, pid, j.status(), j.Cmdline)
+			}
+
+			cmd.Internal.notifyJobs(io.Discard)
+
+			return nil
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-wait", InternalCmd{
+		Synopsis: "l-wait [ids...]",
+		Desc: "Waits for the jobs to finish, or for all the jobs if no IDs are given.\n" +
+			`An ID may be written as "%1". The error of the last job is returned.`,
+		Examples: []string{"sleep 1 &; l-wait %1"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			if len(argv) == 0 {
+				for _, j := range cmd.Internal.jobsAll() {
+					if err := j.wait(ctx, false); err != nil {
+						return err
+					}
+					j.markNotified()
+				}
+				cmd.Internal.notifyJobs(io.Discard)
+				return nil
+			}
+
+			var err error
+			for _, v := range argv {
+				j, e := cmd.Internal.getJob(v)
+				if e != nil {
+					return e
+				}
+
+				if e := j.wait(ctx, false); e != nil {
+					return e
+				}
+
+				_, _, err = j.snapshot()
+				j.markNotified()
+				cmd.Internal.Jobs.Delete(j.ID)
+			}
+
+			return err
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-fg", InternalCmd{
+		Synopsis: "l-fg [id]",
+		Desc:     "Brings a job to the foreground and waits for it, or the last job if no ID is given.",
+		Examples: []string{"l-fg %1"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			id := ""
+			if len(argv) > 0 {
+				id = argv[0]
+			}
+
+			j, err := cmd.Internal.getJob(id)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.Stderr, j.Cmdline)
+
+			return foreground(ctx, cmd, j)
+		},
+	})
+
+	cmd.Internal.Cmds.Store("l-bg", InternalCmd{
+		Synopsis: "l-bg [id]",
+		Desc:     "Resumes a stopped job in the background, or the last job if no ID is given.",
+		Examples: []string{"l-bg %1"},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			id := ""
+			if len(argv) > 0 {
+				id = argv[0]
+			}
+
+			j, err := cmd.Internal.getJob(id)
+			if err != nil {
+				return err
+			}
+
+			pid, state, _ := j.snapshot()
+			if state != jobStopped || pid == 0 {
+				return fmt.Errorf("job %d is not stopped", j.ID)
+			}
+
+			if err := continueProcessGroup(pid); err != nil {
+				return err
+			}
+			j.setState(jobRunning)
+
+			fmt.Fprintf(cmd.Stderr, "[%d] %v\n", j.ID, j.Cmdline)
+
+			return nil
+		},
+	})
+}
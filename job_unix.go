@@ -0,0 +1,111 @@
+//go:build !windows
+// +build !windows
+
+package lalash
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// run starts c in a process group of its own and waits for it, keeping track
+// of it being stopped and continued.
+func (j *Job) run(c *exec.Cmd, tty *os.File) error {
+	j.mu.Lock()
+	fg := j.fg
+	j.mu.Unlock()
+
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if fg && tty != nil {
+		c.SysProcAttr.Foreground = true
+		c.SysProcAttr.Ctty = int(tty.Fd())
+	}
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	pid := c.Process.Pid
+	j.setProcess(pid)
+	defer j.setProcess(0)
+
+	for {
+		var ws syscall.WaitStatus
+		_, err := syscall.Wait4(pid, &ws, syscall.WUNTRACED|syscall.WCONTINUED, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case ws.Stopped():
+			j.setState(jobStopped)
+
+		case ws.Continued():
+			j.setState(jobRunning)
+
+		case ws.Exited(), ws.Signaled():
+			// The process is already reaped; this only waits for the
+			// goroutines copying its output.
+			c.Wait()
+			return exitError(ws)
+		}
+	}
+}
+
+func exitError(ws syscall.WaitStatus) error {
+	switch {
+	case ws.Signaled():
+		return fmt.Errorf("signal: %v", ws.Signal())
+	case ws.ExitStatus() != 0:
+		return fmt.Errorf("exit status %d", ws.ExitStatus())
+	}
+	return nil
+}
+
+func continueProcessGroup(pgid int) error {
+	return syscall.Kill(-pgid, syscall.SIGCONT)
+}
+
+// catchStopSignals keeps the interactive shell from being stopped from the
+// terminal. The signals are caught rather than ignored, since ignored signals
+// stay ignored in the commands the shell executes.
+func catchStopSignals() {
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGTSTP, syscall.SIGTTIN)
+}
+
+func killProcessGroup(pgid int) error {
+	return syscall.Kill(-pgid, syscall.SIGKILL)
+}
+
+func isTerminal(f *os.File) bool {
+	var pgid int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgid)))
+	return errno == 0
+}
+
+// setForeground hands the terminal to the process group pgid, or back to the
+// shell if pgid is 0.
+func setForeground(tty *os.File, pgid int) error {
+	if pgid == 0 {
+		pgid = syscall.Getpgrp()
+	}
+
+	// A background process group gets SIGTTOU when it takes the terminal
+	// back, unless the signal is ignored.
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	p := int32(pgid)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), syscall.TIOCSPGRP, uintptr(unsafe.Pointer(&p)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
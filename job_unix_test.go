@@ -0,0 +1,109 @@
+//go:build !windows
+// +build !windows
+
+package lalash
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalChild(t *testing.T) {
+	cmd, _ := newTestCmd()
+
+	if err := EvalString(context.Background(), cmd, "sh -c {kill -INT $$}"); err == nil || !strings.Contains(err.Error(), "interrupt") {
+		t.Errorf("err = %v, want signal: interrupt", err)
+	}
+
+	if err := EvalString(context.Background(), cmd, "sleep 10 &"); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := cmd.Internal.getJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pid int
+	for i := 0; i < 100 && pid == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		pid, _, _ = j.snapshot()
+	}
+	if pid == 0 {
+		t.Fatal("the job did not start")
+	}
+
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EvalString(context.Background(), cmd, "l-wait"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := j.snapshot(); err == nil || err.Error() != "signal: terminated" {
+		t.Errorf("err = %v, want signal: terminated", err)
+	}
+}
+
+func TestSuspendForeground(t *testing.T) {
+	cmd, out := newTestCmd()
+
+	c := cmd.execCmd(context.Background(), []string{"sh", "-c", "kill -TSTP $$; echo resumed"})
+	if err := runForeground(context.Background(), cmd, c, "sh"); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := cmd.Internal.getJob("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, state, _ := j.snapshot(); state != jobStopped {
+		t.Fatalf("state = %v, want %v", state, jobStopped)
+	}
+
+	if err := EvalString(context.Background(), cmd, "l-fg"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "resumed\n") {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestCancelForeground(t *testing.T) {
+	cmd, _ := newTestCmd()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	c := cmd.execCmd(context.Background(), []string{"sleep", "10"})
+	if err := runForeground(ctx, cmd, c, "sleep 10"); err == nil {
+		t.Errorf("err = nil, want an error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("cancelled after %v", d)
+	}
+	if _, err := cmd.Internal.getJob(""); err == nil {
+		t.Errorf("the killed command was left in the job table")
+	}
+}
+
+func TestExecNoGoroutineLeak(t *testing.T) {
+	cmd, _ := newTestCmd()
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		if err := EvalString(context.Background(), cmd, "true"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines: %d before, %d after", before, after)
+	}
+}
@@ -0,0 +1,41 @@
+package lalash
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// run starts c and waits for it. Jobs cannot be stopped on Windows.
+func (j *Job) run(c *exec.Cmd, tty *os.File) error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	j.setProcess(c.Process.Pid)
+	defer j.setProcess(0)
+
+	return c.Wait()
+}
+
+func continueProcessGroup(pgid int) error {
+	return fmt.Errorf("job control is not supported")
+}
+
+func catchStopSignals() {}
+
+func killProcessGroup(pgid int) error {
+	p, err := os.FindProcess(pgid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
+
+func isTerminal(f *os.File) bool {
+	return false
+}
+
+func setForeground(tty *os.File, pgid int) error {
+	return fmt.Errorf("job control is not supported")
+}
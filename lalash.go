@@ -1,7 +1,6 @@
 package lalash
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
@@ -9,14 +8,13 @@ import (
 	"log"
 	"os"
 	"strings"
+	"syscall"
 
-	"github.com/peterh/liner"
-	"github.com/w-haibara/lalash/history"
+	"github.com/w-haibara/lalash/editor"
 )
 
 const (
-	historyFileName = ".lalash_history"
-	exitCodeOK      = iota - 1
+	exitCodeOK = iota
 	exitCodeErr
 )
 
@@ -27,33 +25,50 @@ var (
 
 func RunCommand(expr string) int {
 	cmd := cmdNew()
+	cmd.signals = newSignals(cmd, os.Interrupt, syscall.SIGTERM)
+	defer cmd.signals.stop()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := cmd.signals.context(context.Background())
 	defer cancel()
 
-	if err := EvalString(ctx, cmd, expr); err != nil {
+	if err := cmd.evalLine(ctx, expr); err != nil && err != shellExitErr {
 		fmt.Println(err.Error())
-		return exitCodeErr
+		return cmd.exit(exitCodeErr)
 	}
 
-	return exitCodeOK
+	return cmd.exit(exitCodeOK)
 }
 
 func RunScript(script io.Reader) int {
+	return runScript(script, "")
+}
+
+// runScript runs script, which is read from the file name if it is not "".
+func runScript(script io.Reader, name string) int {
 	cmd := cmdNew()
+	cmd.signals = newSignals(cmd, os.Interrupt, syscall.SIGTERM)
+	defer cmd.signals.stop()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := cmd.signals.context(context.Background())
 	defer cancel()
 
-	s := bufio.NewScanner(script)
-	for s.Scan() {
-		if err := EvalString(ctx, cmd, s.Text()); err != nil {
-			fmt.Println(err.Error())
-			return exitCodeErr
+	if name != "" {
+		if p, err := cmd.absPath(name); err == nil {
+			name = p
+		}
+	}
+
+	if err := scanScript(script, func(expr string, line int) error {
+		if name != "" {
+			return cmd.evalLine(withSourcePos(ctx, name, line), expr)
 		}
+		return cmd.evalLine(ctx, expr)
+	}); err != nil && err != shellExitErr {
+		fmt.Println(err.Error())
+		return cmd.exit(exitCodeErr)
 	}
 
-	return exitCodeOK
+	return cmd.exit(exitCodeOK)
 }
 
 func RunScriptFile(filename string) int {
@@ -62,54 +77,86 @@ func RunScriptFile(filename string) int {
 		fmt.Println(err)
 		return exitCodeErr
 	}
-	return RunScript(f)
+	defer f.Close()
+	return runScript(f, filename)
 }
 
-func RunREPL() int {
+// promptTail returns the last line of a prompt.
+func promptTail(prompt string) string {
+	return prompt[strings.LastIndex(prompt, "\n")+1:]
+}
+
+func RunREPL(opts Options) int {
 	cmd := cmdNew()
+	if isTerminal(os.Stdin) {
+		cmd.tty = os.Stdin
+		catchStopSignals()
+	}
 
-	line := liner.NewLiner()
-	defer line.Close()
+	cmd.signals = newSignals(cmd, os.Interrupt)
+	defer cmd.signals.stop()
 
-	line.SetCompleter(func(line string) (c []string) {
-		if len(strings.TrimSpace(line)) <= 0 {
-			return nil
-		}
-		for _, v := range cmd.Internal.GetCmdsAll() {
-			if strings.HasPrefix(v, line) {
-				c = append(c, v)
-			}
-		}
-		for _, v := range cmd.Internal.GetAliasAll() {
-			if strings.HasPrefix(v, line) {
-				c = append(c, v)
-			}
-		}
-		return
-	})
+	// The editor is made before the startup files, which may bind keys.
+	cmd.line = editor.New(os.Stdin, os.Stdout)
 
-	line.SetCtrlCAborts(false)
+	func() {
+		ctx, cancel := cmd.signals.context(context.Background())
+		defer cancel()
 
-	history := history.New(historyFileName)
-	history.ReadHistory(line)
-	defer history.WriteHistory(line)
+		loadStartupFiles(ctx, cmd, opts)
+	}()
+
+	if h, err := cmd.openHistory(); err != nil {
+		fmt.Fprintln(cmd.Stderr, "history:", err.Error())
+	} else {
+		cmd.hist = h
+	}
+
+	line := cmd.line
+	line.Highlight = cmd.highlight
+	line.Complete = cmd.complete
+	line.Suggest = cmd.suggest
+	line.Refresh = func() string {
+		return promptTail(cmd.prompt(context.Background()))
+	}
+	if cmd.hist != nil {
+		for _, e := range cmd.hist.Entries() {
+			line.AppendHistory(e.Line)
+		}
+	}
 
 	for {
 		if err := func() error {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
+			cmd.Internal.notifyJobs(cmd.Stderr)
 
-			expr, err := line.Prompt("$ ")
+			// The line editor takes only the last line of the prompt.
+			prompt := cmd.prompt(context.Background())
+			fmt.Fprint(cmd.Stdout, strings.TrimSuffix(prompt, promptTail(prompt)))
+
+			expr, err := line.Prompt(promptTail(prompt))
+			if err == io.EOF {
+				return shellExitErr
+			}
 			if err != nil {
 				return fmt.Errorf("[read line error] %v", err.Error())
 			}
-			line.AppendHistory(expr)
 
-			return EvalString(ctx, cmd, expr)
+			ctx, cancel := cmd.signals.context(context.Background())
+			defer cancel()
+
+			err = cmd.evalLine(ctx, expr)
+
+			if ok, err := cmd.addHistory(expr); err != nil {
+				fmt.Fprintln(cmd.Stderr, "history:", err.Error())
+			} else if ok {
+				line.AppendHistory(expr)
+			}
+
+			return err
 		}(); err != nil {
 			switch err {
 			case shellExitErr:
-				return exitCodeOK
+				return cmd.exit(exitCodeOK)
 			case funcReturnErr:
 				log.Println("[func return error] here is the main routine")
 				continue
@@ -7,10 +7,42 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/user"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/w-haibara/lalash/editor"
+	"github.com/w-haibara/lalash/history"
+	"github.com/w-haibara/lalash/parser"
 )
 
+// lockedWriter serializes writes from background jobs and the shell.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+func newTestCmd() (Command, *bytes.Buffer) {
+	cmd := cmdNew()
+	cmd.Stdin = strings.NewReader("")
+
+	var out bytes.Buffer
+	w := &lockedWriter{w: &out}
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	return cmd, &out
+}
+
 func TestEvalString(t *testing.T) {
 	outputFiles := "./testfiles/out"
 	if err := os.RemoveAll(outputFiles); err != nil {
@@ -402,6 +434,22 @@ func TestEvalString(t *testing.T) {
 			stderr: "",
 			err:    nil,
 		},
+		{
+			name:   "alias3",
+			expr:   `l-fn first {l-echo (l-arg 0)}; l-alias f {first}; f "a  b" c`,
+			stdin:  "",
+			stdout: "a  b\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "alias4",
+			expr:   `l-fn first {l-echo (l-arg 0)}; l-alias f {first}; f "a; l-echo b" c`,
+			stdin:  "",
+			stdout: "a; l-echo b\n",
+			stderr: "",
+			err:    nil,
+		},
 
 		/*
 			pipe
@@ -612,48 +660,799 @@ func TestEvalString(t *testing.T) {
 			stderr: "",
 			err:    nil,
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			cmd := cmdNew()
-
-			i := strings.NewReader(tt.stdin)
-			cmd.Stdin = i
 
-			var stdout bytes.Buffer
-			o := bufio.NewWriter(&stdout)
-			cmd.Stdout = o
+		/*
+			string func
+		*/
+		{
+			name:   "string func1",
+			expr:   `s-fields-func a1b22c digit`,
+			stdin:  "",
+			stdout: "a\nb\nc\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "string func2",
+			expr:   `s-trim-func "  abc  " space`,
+			stdin:  "",
+			stdout: "abc\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "string func3",
+			expr:   `l-fn aaa {s-contains aeiou (l-arg 0)}; s-index-func hello aaa; s-last-index-func hello aaa`,
+			stdin:  "",
+			stdout: "1\n4\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "string func4",
+			expr:   `s-trim-left-func xyabc {s-contains xyz (l-arg 0)}`,
+			stdin:  "",
+			stdout: "abc\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "string func5",
+			expr:   `s-map upper abc; s-map {s-repeat (l-arg 0) 2} abc`,
+			stdin:  "",
+			stdout: "ABC\naabbcc\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "string func6",
+			expr:   `s-to-upper-spechial turkish i`,
+			stdin:  "",
+			stdout: "\u0130\n",
+			stderr: "",
+			err:    nil,
+		},
 
-			var stderr bytes.Buffer
-			e := bufio.NewWriter(&stderr)
-			cmd.Stderr = e
+		/*
+			regexp
+		*/
+		{
+			name:   "regexp1",
+			expr:   `r-match {^a.c$} abc; r-match {^a.c$} abd`,
+			stdin:  "",
+			stdout: "true\nfalse\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "regexp2",
+			expr:   `r-find-all {[0-9]+} ab12cd345`,
+			stdin:  "",
+			stdout: "12\n345\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "regexp3",
+			expr:   `r-replace {(\w+)@(\w+)} {$2 at $1} foo@bar`,
+			stdin:  "",
+			stdout: "bar at foo\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "regexp4",
+			expr:   `r-split {,\s*} "a, b,c"`,
+			stdin:  "",
+			stdout: "a\nb\nc\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "regexp5",
+			expr:   `r-named-groups {(?P<key>\w+)=(?P<val>\w+)} x=y`,
+			stdin:  "",
+			stdout: "key : x\nval : y\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "regexp6",
+			expr:   `r-find {[0-9]+}`,
+			stdin:  "ab12cd\n",
+			stdout: "12\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "regexp7",
+			expr:   `r-quote a.b`,
+			stdin:  "",
+			stdout: "a\\.b\n",
+			stderr: "",
+			err:    nil,
+		},
 
-			if tt.inExtra != nil {
-				cmd.ExtraFiles = make([]*os.File, len(tt.inExtra))
-				for i, v := range tt.inExtra {
-					if v == "" {
-						continue
-					}
+		/*
+			json
+		*/
+		{
+			name:   "json1",
+			expr:   `j-get .a.b[1].c`,
+			stdin:  "{\"a\":{\"b\":[1,{\"c\":\"x\"}]}}\n",
+			stdout: "x\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "json2",
+			expr:   `j-get .a[*].n`,
+			stdin:  "{\"a\":[{\"n\":1},{\"n\":2}]}",
+			stdout: "1\n2\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "json3",
+			expr:   `j-set .a.c {[1,2]}`,
+			stdin:  "{\"a\":{\"b\":0}}\n",
+			stdout: "{\"a\":{\"b\":0,\"c\":[1,2]}}\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "json4",
+			expr:   `j-del .a[0]`,
+			stdin:  "{\"a\":[1,2]}\n",
+			stdout: "{\"a\":[2]}\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "json5",
+			expr:   `j-keys {{"b":1,"a":2}}; j-len -p .a {{"a":[1,2,3]}}; j-type -p .a {{"a":null}}`,
+			stdin:  "",
+			stdout: "a\nb\n3\nnull\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "json6",
+			expr:   `j-compact`,
+			stdin:  "{ \"a\" : [ 1, 2 ] }\n",
+			stdout: "{\"a\":[1,2]}\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "json7",
+			expr:   `j-to-var cfg {{"a":{"b":"x"},"c":[1,2]}}; l-var --ref cfg.a.b; j-from-var --prefix cfg`,
+			stdin:  "",
+			stdout: "x\n{\"a\":{\"b\":\"x\"},\"c\":[1,2]}\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "json9",
+			expr:   `j-to-var --mut v {{"n":1.5,"t":true,"z":null,"s":"1","e":{},"l":[]}}; l-var --ref v.e; j-from-var --prefix v; l-var --ch v.n 2; j-from-var v.n v.t`,
+			stdin:  "",
+			stdout: "{}\n{\"e\":{},\"l\":[],\"n\":1.5,\"s\":\"1\",\"t\":true,\"z\":null}\n{\"v.n\":\"2\",\"v.t\":true}\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "json8",
+			expr:   `l-var aaa xxx; j-from-var aaa`,
+			stdin:  "",
+			stdout: "{\"aaa\":\"xxx\"}\n",
+			stderr: "",
+			err:    nil,
+		},
 
-					tmp, err := os.CreateTemp("", fmt.Sprint("lalash_test_extra_input_", i))
-					if err != nil {
-						panic(err.Error())
-					}
-					defer tmp.Close()
-					defer os.Remove(tmp.Name())
+		/*
+			csv
+		*/
+		{
+			name:   "csv1",
+			expr:   `csv-header`,
+			stdin:  "name,cpu\nweb,80\n",
+			stdout: "name\ncpu\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "csv2",
+			expr:   `csv-count`,
+			stdin:  "name,cpu\nweb,80\ndb,9\n",
+			stdout: "2\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "csv3",
+			expr:   `csv-select cpu,0`,
+			stdin:  "name,cpu\nweb,80\n\"a,b\",9\n",
+			stdout: "cpu,name\n80,web\n9,\"a,b\"\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "csv4",
+			expr:   `csv-sort -k cpu -n`,
+			stdin:  "name,cpu\nweb,80\ndb,9\n",
+			stdout: "name,cpu\ndb,9\nweb,80\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "csv5",
+			expr:   `csv-filter {s-has-prefix (l-arg 0) d}`,
+			stdin:  "name,cpu\nweb,80\ndb,9\n",
+			stdout: "name,cpu\ndb,9\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "csv6",
+			expr:   `csv-to-json --tsv`,
+			stdin:  "name\tcpu\nweb\t80\n",
+			stdout: "[{\"name\":\"web\",\"cpu\":\"80\"}]\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "csv7",
+			expr:   `csv-from-json --cols cpu,name`,
+			stdin:  "[{\"name\":\"web\",\"cpu\":80}]",
+			stdout: "cpu,name\n80,web\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "csv8",
+			expr:   `csv-select --no-header --quote all 1`,
+			stdin:  "web,80\n",
+			stdout: "\"80\"\n",
+			stderr: "",
+			err:    nil,
+		},
 
-					_, err = io.WriteString(tmp, v)
-					if err != nil {
-						panic(err.Error())
-					}
-					tmp.Close()
+		/*
+			file
+		*/
+		{
+			name:   "file1",
+			expr:   `f-mkdir -p testfiles/out/f1/a; f-write testfiles/out/f1/a/x abc; f-append testfiles/out/f1/a/x def; f-read testfiles/out/f1/a/x`,
+			stdin:  "",
+			stdout: "abc\ndef\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "file2",
+			expr:   `f-mkdir -p testfiles/out/f2/a; f-touch testfiles/out/f2/a/x; f-cp -r testfiles/out/f2/a testfiles/out/f2/b; f-walk -type f testfiles/out/f2`,
+			stdin:  "",
+			stdout: "testfiles/out/f2/a/x\ntestfiles/out/f2/b/x\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "file3",
+			expr:   `f-mkdir testfiles/out/f3; f-touch testfiles/out/f3/x; f-mv testfiles/out/f3/x testfiles/out/f3/y; f-exists testfiles/out/f3/x; f-exists -f testfiles/out/f3/y; f-exists -d testfiles/out/f3/y`,
+			stdin:  "",
+			stdout: "false\ntrue\nfalse\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "file4",
+			expr:   `f-mkdir testfiles/out/f4; f-touch testfiles/out/f4/b testfiles/out/f4/a testfiles/out/f4/.c; f-ls testfiles/out/f4; f-glob testfiles/out/f4/?`,
+			stdin:  "",
+			stdout: "a\nb\ntestfiles/out/f4/a\ntestfiles/out/f4/b\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "file5",
+			expr:   `f-mkdir -p testfiles/out/f5/a; f-rm -r testfiles/out/f5/a; f-rm -f testfiles/out/f5/a; f-ls testfiles/out/f5`,
+			stdin:  "",
+			stdout: "",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "file6",
+			expr:   `f-write testfiles/out/f6; f-read testfiles/out/f6`,
+			stdin:  "abc\n",
+			stdout: "abc\n",
+			stderr: "",
+			err:    nil,
+		},
 
-					tmp, err = os.Open(tmp.Name())
-					if err != nil {
-						panic(err.Error())
-					}
+		/*
+			path
+		*/
+		{
+			name:   "path1",
+			expr:   `p-join a b c.go; p-base a/b.go; p-dir a/b.go; p-ext a/b.tar.gz`,
+			stdin:  "",
+			stdout: "a/b/c.go\nb.go\na\n.gz\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "path2",
+			expr:   `p-rel /a /a/b/c; p-clean a/b/../c; p-split a/b/c.go`,
+			stdin:  "",
+			stdout: "b/c\na/c\na/b/\nc.go\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "path3",
+			expr:   `p-match "*.go" x.go; p-match "*.go" x.c`,
+			stdin:  "",
+			stdout: "true\nfalse\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "path4",
+			expr:   `l-echo (p-base (p-dir a/b/c))`,
+			stdin:  "",
+			stdout: "b\n",
+			stderr: "",
+			err:    nil,
+		},
 
-					cmd.ExtraFiles[i] = tmp
+		/*
+			glob
+		*/
+		{
+			name:   "glob1",
+			expr:   `f-mkdir -p testfiles/out/g1/a/b; f-touch testfiles/out/g1/x.txt testfiles/out/g1/y.txt testfiles/out/g1/a/b/z.txt testfiles/out/g1/.h.txt; l-echo testfiles/out/g1/*.txt`,
+			stdin:  "",
+			stdout: "testfiles/out/g1/x.txt testfiles/out/g1/y.txt\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "glob2",
+			expr:   `f-mkdir -p testfiles/out/g2/a/b; f-touch testfiles/out/g2/x.txt testfiles/out/g2/a/b/z.txt; l-echo testfiles/out/g2/**/*.txt`,
+			stdin:  "",
+			stdout: "testfiles/out/g2/a/b/z.txt testfiles/out/g2/x.txt\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "glob3",
+			expr:   `l-echo "testfiles/*" {testfiles/*} testfiles/?n`,
+			stdin:  "",
+			stdout: "testfiles/* testfiles/* testfiles/in\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "glob4",
+			expr:   `l-echo testfiles/nomatch*; l-var GLOB_NOMATCH null; l-echo a testfiles/nomatch*`,
+			stdin:  "",
+			stdout: "testfiles/nomatch*\na\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:  "glob5",
+			expr:  `l-echo ~ ~/abc`,
+			stdin: "",
+			stdout: func() string {
+				home, _ := os.UserHomeDir()
+				return home + " " + home + "/abc\n"
+			}(),
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "glob6",
+			expr:   `l-echo a//b {/*c*/}`,
+			stdin:  "",
+			stdout: "a//b /*c*/\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "glob7",
+			expr:   `l-echo ~nosuchuser-lalash/a; p-expand ~nosuchuser-lalash`,
+			stdin:  "",
+			stdout: "~nosuchuser-lalash/a\n",
+			stderr: "",
+			err:    user.UnknownUserError("nosuchuser-lalash"),
+		},
+		{
+			name:   "glob8",
+			expr:   `l-echo a[ [-1]; r-find-all [a-]+ xa-; l-pipe {l-echo {{"a":[1,2]}}} {j-get .a[-1]}`,
+			stdin:  "",
+			stdout: "a[ [-1]\na-\n2\n",
+			stderr: "",
+			err:    nil,
+		},
+
+		/*
+			brace expansion
+		*/
+		{
+			name:   "brace1",
+			expr:   `l-echo file@{1..3}.log`,
+			stdin:  "",
+			stdout: "file1.log file2.log file3.log\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "brace2",
+			expr:   `l-echo src/@{a,b}/main.go @{x,y@{1,2}}`,
+			stdin:  "",
+			stdout: "src/a/main.go src/b/main.go x y1 y2\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "brace3",
+			expr:   `l-echo @{01..10..3} @{5..1..2}`,
+			stdin:  "",
+			stdout: "01 04 07 10 5 3 1\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "brace4",
+			expr:   `l-echo {@{a,b}} "@{a,b}"; l-eval {l-echo @{a,b}}`,
+			stdin:  "",
+			stdout: "@{a,b} @{a,b}\na b\n",
+			stderr: "",
+			err:    nil,
+		},
+
+		/*
+			job
+		*/
+		{
+			name:   "job1",
+			expr:   `l-echo abc & l-wait; l-jobs`,
+			stdin:  "",
+			stdout: "abc\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "job2",
+			expr:   `l-fn aaa {l-echo abc}; aaa & l-wait 1; l-wait`,
+			stdin:  "",
+			stdout: "abc\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "job3",
+			expr:   `sh -c {kill -STOP $$; echo resumed} & sleep 0.5; l-bg 1; l-wait 1`,
+			stdin:  "",
+			stdout: "resumed\n",
+			stderr: "[1] sh -c {kill -STOP $$; echo resumed}\n",
+			err:    nil,
+		},
+		{
+			name:   "job4",
+			expr:   `sh -c {kill -STOP $$; echo resumed} & sleep 0.5; l-fg`,
+			stdin:  "",
+			stdout: "resumed\n",
+			stderr: "sh -c {kill -STOP $$; echo resumed}\n",
+			err:    nil,
+		},
+
+		/*
+			trap
+		*/
+		{
+			name:   "trap1",
+			expr:   `l-trap {l-echo bye} EXIT sigterm; l-trap {} INT; l-trap --list`,
+			stdin:  "",
+			stdout: "EXIT : l-echo bye\nINT : \nTERM : l-echo bye\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "trap2",
+			expr:   `l-trap {l-echo bye} EXIT TERM; l-trap --reset term; l-trap --list`,
+			stdin:  "",
+			stdout: "EXIT : l-echo bye\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "trap3",
+			expr:   `l-trap {l-echo bye} EXIT TERM; l-trap --reset; l-trap --list`,
+			stdin:  "",
+			stdout: "",
+			stderr: "",
+			err:    nil,
+		},
+
+		/*
+			task
+		*/
+		{
+			name:   "task1",
+			expr:   `l-await (l-go {l-echo abc})`,
+			stdin:  "",
+			stdout: "abc\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "task2",
+			expr:   `l-var t (l-go {l-echo (l-arg 0) (l-arg 1)} x y); l-await (l-var --ref t)`,
+			stdin:  "",
+			stdout: "x y\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "task3",
+			expr:   `l-chan create -n 1 c; l-await (l-go {l-chan send c hello}); l-chan recv c`,
+			stdin:  "",
+			stdout: "hello\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "task4",
+			expr:   `l-chan create c; l-var t (l-go {l-chan send c a; l-chan send c b; l-chan close c}); l-chan recv c; l-chan recv c; l-await (l-var --ref t)`,
+			stdin:  "",
+			stdout: "a\nb\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "task5",
+			expr:   `l-chan create a; l-chan create -n 1 b; l-chan send b xyz; l-select a {l-echo a (l-arg 0)} b {l-echo b (l-arg 0)}`,
+			stdin:  "",
+			stdout: "b xyz\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "task6",
+			expr:   `l-chan create a; l-select --default {l-echo none} a {l-echo a}`,
+			stdin:  "",
+			stdout: "none\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "task7",
+			expr:   `l-chan create -n 1 a; l-chan send a last; l-chan close a; l-select a {l-echo got (l-arg 0)}`,
+			stdin:  "",
+			stdout: "got last\n",
+			stderr: "",
+			err:    nil,
+		},
+
+		/*
+			parallel
+		*/
+		{
+			name:   "parallel1",
+			expr:   `l-parallel -j 2 {l-echo item (l-arg 0)} a b c`,
+			stdin:  "",
+			stdout: "item a\nitem b\nitem c\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "parallel2",
+			expr:   `l-parallel -j 3 {sleep (l-arg 0); l-echo (l-arg 0)} 0.3 0.1 0.2`,
+			stdin:  "",
+			stdout: "0.3\n0.1\n0.2\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "parallel3",
+			expr:   `l-parallel {l-echo (s-to-upper (l-arg 0))}`,
+			stdin:  "x\n\ny\n",
+			stdout: "X\nY\n",
+			stderr: "",
+			err:    nil,
+		},
+
+		/*
+			timeout
+		*/
+		{
+			name:   "timeout1",
+			expr:   `l-timeout 5s {l-echo ok}`,
+			stdin:  "",
+			stdout: "ok\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "retry1",
+			expr:   `l-retry -n 2 --delay 1ms {l-echo (l-arg 0)} ok`,
+			stdin:  "",
+			stdout: "ok\n",
+			stderr: "",
+			err:    nil,
+		},
+
+		/*
+			dir
+		*/
+		{
+			name:   "dir1",
+			expr:   `l-cd testfiles; p-base (l-pwd)`,
+			stdin:  "",
+			stdout: "testfiles\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "dir2",
+			expr:   `l-cd testfiles; l-var d (l-cd -); p-rel (l-pwd) (l-var --ref d)`,
+			stdin:  "",
+			stdout: ".\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "dir3",
+			expr:   `l-pushd testfiles; p-base (l-pwd); l-popd; f-exists -d testfiles`,
+			stdin:  "",
+			stdout: "testfiles\ntrue\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "dir4",
+			expr:   `l-pushd testfiles; l-pushd; f-exists -d testfiles; l-pushd; f-exists -d out`,
+			stdin:  "",
+			stdout: "true\ntrue\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "dir5",
+			expr:   `l-var CDPATH testfiles; l-var d (l-cd out); p-base (l-pwd)`,
+			stdin:  "",
+			stdout: "out\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "dir6",
+			expr:   `l-cd testfiles; ls -d ../testfiles`,
+			stdin:  "",
+			stdout: "../testfiles\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "dir7",
+			expr:   `l-await (l-go {l-cd testfiles}); f-exists -d testfiles`,
+			stdin:  "",
+			stdout: "true\n",
+			stderr: "",
+			err:    nil,
+		},
+
+		/*
+			source
+		*/
+		{
+			name:   "source1",
+			expr:   `l-source testfiles/in/source.lsh world; greet (l-var --ref name)`,
+			stdin:  "",
+			stdout: "hello world\nbye world\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "source2",
+			expr:   `l-source testfiles/in/comment.lsh; note; tag`,
+			stdin:  "",
+			stdout: "# c\na\nb\n{tag}\n",
+			stderr: "",
+			err:    nil,
+		},
+
+		/*
+			import
+		*/
+		{
+			name:   "import1",
+			expr:   `l-var LALASH_PATH testfiles/in/lib; l-import greet; greet.hello world; l-echo (l-var --ref greet.greeting)`,
+			stdin:  "",
+			stdout: "hello world\nhello\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "import2",
+			expr:   `l-import ./testfiles/in/lib/greet.lsh as g; g.hello x; l-import --list`,
+			stdin:  "",
+			stdout: "hello x\ng : testfiles/in/lib/greet.lsh\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "import3",
+			expr:   `l-var LALASH_PATH testfiles/in/lib; l-import greet; l-import greet; l-import greet as g; l-import --list`,
+			stdin:  "",
+			stdout: "g : testfiles/in/lib/greet.lsh\ngreet : testfiles/in/lib/greet.lsh\n",
+			stderr: "",
+			err:    nil,
+		},
+
+		/*
+			prompt
+		*/
+		{
+			name:   "prompt1",
+			expr:   `pr-color bold,red abc def`,
+			stdin:  "",
+			stdout: "\u001b[1;31mabc def\u001b[0m\n",
+			stderr: "",
+			err:    nil,
+		},
+		{
+			name:   "prompt2",
+			expr:   `l-cd testfiles; pr-cwd -b`,
+			stdin:  "",
+			stdout: "testfiles\n",
+			stderr: "",
+			err:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := cmdNew()
+
+			i := strings.NewReader(tt.stdin)
+			cmd.Stdin = i
+
+			var stdout bytes.Buffer
+			o := bufio.NewWriter(&stdout)
+			cmd.Stdout = &lockedWriter{w: o}
+
+			var stderr bytes.Buffer
+			e := bufio.NewWriter(&stderr)
+			cmd.Stderr = &lockedWriter{w: e}
+
+			if tt.inExtra != nil {
+				cmd.ExtraFiles = make([]*os.File, len(tt.inExtra))
+				for i, v := range tt.inExtra {
+					if v == "" {
+						continue
+					}
+
+					tmp, err := os.CreateTemp("", fmt.Sprint("lalash_test_extra_input_", i))
+					if err != nil {
+						panic(err.Error())
+					}
+					defer tmp.Close()
+					defer os.Remove(tmp.Name())
+
+					_, err = io.WriteString(tmp, v)
+					if err != nil {
+						panic(err.Error())
+					}
+					tmp.Close()
+
+					tmp, err = os.Open(tmp.Name())
+					if err != nil {
+						panic(err.Error())
+					}
+
+					cmd.ExtraFiles[i] = tmp
 				}
 			}
 
@@ -683,3 +1482,742 @@ func TestEvalString(t *testing.T) {
 		})
 	}
 }
+
+func TestParallelFailure(t *testing.T) {
+	cmd, out := newTestCmd()
+
+	err := EvalString(context.Background(), cmd, `l-parallel -j 1 {test (l-arg 0) != b; l-echo (l-arg 0)} a b c`)
+	if err == nil || err.Error() != "1 of 3 items failed" {
+		t.Errorf("err = %v", err)
+	}
+	if got, want := out.String(), "a\nb : exit status 1\nc\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	err = EvalString(context.Background(), cmd, `l-parallel -j 1 --fail-fast {test (l-arg 0) != b; l-echo (l-arg 0)} a b c`)
+	if err == nil || err.Error() != "b: exit status 1" {
+		t.Errorf("err = %v", err)
+	}
+	if got, want := out.String(), "a\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestTaskAcrossLines(t *testing.T) {
+	cmd, out := newTestCmd()
+
+	// Each line of the shell has its own context, cancelled when it ends.
+	ctx, cancel := context.WithCancel(context.Background())
+	err := cmd.evalLine(ctx, `l-var --global t (l-go {sleep 0.2; l-echo done})`)
+	cancel()
+	if err != nil {
+		t.Fatalf("err = %v", err)
+	}
+
+	if err := cmd.evalLine(context.Background(), `l-await (l-var --ref t)`); err != nil {
+		t.Errorf("err = %v", err)
+	}
+	if got, want := out.String(), "done\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	err = cmd.evalLine(context.Background(), `l-fn f {l-go {sleep 10; l-echo after}}; l-await (f)`)
+	if err == nil || err.Error() != "task 1: context canceled" {
+		t.Errorf("err = %v", err)
+	}
+
+	for i := 0; i < 2*maxDoneTasks; i++ {
+		if err := cmd.evalLine(context.Background(), `l-go {l-echo x}`); err != nil {
+			t.Fatalf("err = %v", err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := cmd.evalLine(context.Background(), `l-go {l-echo x}`); err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	n := 0
+	cmd.Internal.Tasks.Range(func(key, value interface{}) bool {
+		n++
+		return true
+	})
+	if n > maxDoneTasks {
+		t.Errorf("%d tasks are kept", n)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	cmd, out := newTestCmd()
+
+	start := time.Now()
+	err := EvalString(context.Background(), cmd, `l-timeout 100ms {sleep 10; l-echo after}`)
+	if err == nil || err.Error() != "timed out after 100ms" {
+		t.Errorf("err = %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("timed out after %v", d)
+	}
+	if out.String() != "" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestRegexpCache(t *testing.T) {
+	cmd, _ := newTestCmd()
+
+	for i := 0; i < 3*maxRegexps; i++ {
+		if _, err := cmd.Internal.compileRegexp(fmt.Sprintf("a{%d}", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n := 0
+	cmd.Internal.Regexp.Range(func(key, value interface{}) bool {
+		n++
+		return true
+	})
+	if n > maxRegexps {
+		t.Errorf("%d patterns are cached", n)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	cmd, out := newTestCmd()
+	file := filepath.Join(t.TempDir(), "attempts")
+
+	err := EvalString(context.Background(), cmd, `l-retry -n 3 --delay 1ms --backoff exp {f-append -n `+file+` x; test (f-read `+file+`) = xxx}`)
+	if err != nil {
+		t.Errorf("err = %v", err)
+	}
+	if got, want := out.String(), "attempt 1 failed: exit status 1\nattempt 2 failed: exit status 1\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	err = EvalString(context.Background(), cmd, `l-retry -n 2 --delay 1ms false`)
+	if err == nil || err.Error() != "failed after 2 attempts: exit status 1" {
+		t.Errorf("err = %v", err)
+	}
+	if got, want := out.String(), "attempt 1 failed: exit status 1\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestImportNested(t *testing.T) {
+	cmd, out := newTestCmd()
+	ctx := context.Background()
+
+	outer, err := filepath.Abs("testfiles/in/lib/nested/outer.lsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr := "l-cd " + t.TempDir() + `; l-import ` + outer + ` as o; o.run "a b"`
+	if err := cmd.evalLine(ctx, expr); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "a b a b\n" {
+		t.Errorf("o.run = %q", got)
+	}
+
+	for _, name := range []string{"o.run", "inner.twice", "o.inner.twice"} {
+		if _, ok := cmd.Internal.Cmds.Load(name); ok {
+			t.Errorf("%v is a builtin", name)
+		}
+	}
+
+	for _, line := range []string{"inner.twice x", "o.inner.twice x", "l-var --ref inner.word", "l-var --ref o.inner.word"} {
+		if err := cmd.evalLine(ctx, line); err == nil {
+			t.Errorf("%v succeeded", line)
+		}
+	}
+
+	out.Reset()
+	if err := cmd.evalLine(ctx, "l-type o.run"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "o.run is the function run of the module o defined at "; !strings.HasPrefix(out.String(), want) {
+		t.Errorf("l-type o.run = %q", out.String())
+	}
+}
+
+func TestJSONPathError(t *testing.T) {
+	cmd, _ := newTestCmd()
+
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{`j-get .a.b {{"a": 1}}`, ".a.b: cannot index number"},
+		{`j-get .c.5 {{"c": [1]}}`, ".c.5: index out of range (length 1)"},
+		{`j-set .a.b 2 {{"a": "x"}}`, ".a.b: cannot index string"},
+	}
+	for _, tt := range tests {
+		if err := cmd.evalLine(context.Background(), tt.expr); err == nil || err.Error() != tt.err {
+			t.Errorf("%v: err = %v, want %v", tt.expr, err, tt.err)
+		}
+	}
+}
+
+func TestCopyInto(t *testing.T) {
+	cmd, _ := newTestCmd()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	if err := cmd.evalLine(ctx, "l-cd "+dir+"; f-mkdir a; f-touch a/x"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"f-cp -r a a/b", "f-cp -r a a"} {
+		if err := cmd.evalLine(ctx, line); err == nil || !strings.Contains(err.Error(), "into itself") {
+			t.Errorf("%v: err = %v", line, err)
+		}
+	}
+
+	if err := cmd.evalLine(ctx, "f-cp -r a ab"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ab", "x")); err != nil {
+		t.Error(err)
+	}
+
+	for abs, want := range map[string]string{
+		filepath.Join(dir, "..foo"):     "..foo",
+		filepath.Join(dir, "a", "x"):    filepath.Join("a", "x"),
+		filepath.Join(dir, "..", "foo"): filepath.Join(filepath.Dir(dir), "foo"),
+	} {
+		if got := cmd.relPath(abs); got != want {
+			t.Errorf("relPath(%v) = %v, want %v", abs, got, want)
+		}
+	}
+}
+
+func TestBraceLimit(t *testing.T) {
+	cmd, _ := newTestCmd()
+
+	for _, expr := range []string{
+		"l-echo @{1..100000000}",
+		"l-echo @{100000000..1}",
+		"l-echo @{-9000000000000000000..9000000000000000000}",
+	} {
+		if err := cmd.evalLine(context.Background(), expr); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("%v: err = %v", expr, err)
+		}
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	cmd, _ := newTestCmd()
+
+	err := EvalString(context.Background(), cmd, `l-import ./testfiles/in/lib/cycle_a.lsh`)
+	if err == nil || !strings.HasSuffix(err.Error(), "import cycle: testfiles/in/lib/cycle_a.lsh -> testfiles/in/lib/cycle_b.lsh -> testfiles/in/lib/cycle_a.lsh") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	cmd, out := newTestCmd()
+	ctx := context.Background()
+
+	if p := cmd.prompt(ctx); p != defaultPrompt {
+		t.Errorf("prompt = %q, want the default", p)
+	}
+
+	if err := cmd.evalLine(ctx, `l-var PROMPT "> "`); err != nil {
+		t.Fatal(err)
+	}
+	if p := cmd.prompt(ctx); p != "> " {
+		t.Errorf("prompt = %q", p)
+	}
+
+	if err := cmd.evalLine(ctx, `l-fn l-prompt {l-echo (pr-status) "%"}`); err != nil {
+		t.Fatal(err)
+	}
+	cmd.evalLine(ctx, "sh -c {exit 3}")
+	if p := cmd.prompt(ctx); p != "3 %" {
+		t.Errorf("prompt = %q", p)
+	}
+	cmd.evalLine(ctx, "true")
+	if p := cmd.prompt(ctx); p != "0 %" {
+		t.Errorf("prompt = %q", p)
+	}
+
+	out.Reset()
+	if err := cmd.evalLine(ctx, `l-fn l-prompt {no-such-command}`); err != nil {
+		t.Fatal(err)
+	}
+	if p := cmd.prompt(ctx); p != defaultPrompt {
+		t.Errorf("prompt = %q, want the default", p)
+	}
+	if !strings.HasPrefix(out.String(), "l-prompt: ") {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestGitBranch(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(sub, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		head, want string
+	}{
+		{"ref: refs/heads/feature/x\n", "feature/x"},
+		{"0123456789abcdef0123456789abcdef01234567\n", "0123456"},
+	} {
+		if err := os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte(tt.head), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := gitBranch(sub); !ok || got != tt.want {
+			t.Errorf("gitBranch() = %q, %v, want %q", got, ok, tt.want)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	cmd, _ := newTestCmd()
+	ctx := context.Background()
+
+	if err := EvalString(ctx, cmd, `l-var abc 1; l-var abd 2; l-fn my-func {l-echo}; l-complete my-func {l-echo alpha; l-echo beta; l-echo (l-arg 1)}`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line       string
+		pos        int
+		head, tail string
+		want       []string
+	}{
+		{"l-ec", -1, "", "", []string{"l-echo "}},
+		{"my-f", -1, "", "", []string{"my-func "}},
+		{"l-echo a; l-ca", -1, "l-echo a; ", "", []string{"l-cat "}},
+		{"l-echo (l-va", -1, "l-echo (", "", []string{"l-var "}},
+		{"l-var --m", -1, "l-var ", "", []string{"--mut "}},
+		{"l-echo (l-var --ref ab", -1, "l-echo (l-var --ref ", "", []string{"abc ", "abd "}},
+		{"l-echo $ab", -1, "l-echo ", "", []string{}},
+		{"l-cat testfiles/i", -1, "l-cat ", "", []string{"testfiles/in/"}},
+		{"l-cat testfiles/in/li x", 21, "l-cat ", " x", []string{"testfiles/in/lib/"}},
+		{"my-func b", -1, "my-func ", "", []string{"beta "}},
+		{"my-func m", -1, "my-func ", "", []string{"my-func "}},
+	}
+	for _, tt := range tests {
+		pos := tt.pos
+		if pos < 0 {
+			pos = len([]rune(tt.line))
+		}
+
+		head, got, tail := cmd.complete(tt.line, pos)
+		if head != tt.head || tail != tt.tail || strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("complete(%q, %d) = %q, %q, %q, want %q, %q, %q", tt.line, pos, head, got, tail, tt.head, tt.want, tt.tail)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	cmd, out := newTestCmd()
+	ctx := context.Background()
+
+	file := filepath.Join(t.TempDir(), "state", "history")
+	if err := cmd.evalLine(ctx, "l-var HISTFILE "+file+"; l-var HISTCONTROL ignoreboth"); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := cmd.openHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.hist = h
+
+	for _, line := range []string{"l-echo a", "l-echo a", " l-echo secret", "sh -c {exit 3}", "l-echo b"} {
+		cmd.evalLine(ctx, line)
+		if _, err := cmd.addHistory(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The entries are in the file before the shell exits.
+	h, err = cmd.openHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := h.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("entries = %v", entries)
+	}
+	if e := entries[1]; e.Line != "sh -c {exit 3}" || e.Status != 3 || e.Cwd != cmd.wd.get() || e.Time.IsZero() {
+		t.Errorf("entry = %+v", e)
+	}
+
+	tests := []struct {
+		expr string
+		out  string
+	}{
+		{"l-history", "    1  l-echo a\n    2  sh -c {exit 3}\n    3  l-echo b\n"},
+		{"l-history -n 1", "    3  l-echo b\n"},
+		{"l-history --search echo", "    1  l-echo a\n    3  l-echo b\n"},
+		{"l-history --run -1", "l-echo b\nb\n"},
+		{"l-history --delete 2; l-history", "    1  l-echo a\n    2  l-echo b\n"},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		if err := cmd.evalLine(ctx, tt.expr); err != nil {
+			t.Fatalf("%v: %v", tt.expr, err)
+		}
+		if out.String() != tt.out {
+			t.Errorf("%v: output = %q, want %q", tt.expr, out.String(), tt.out)
+		}
+	}
+
+	if err := cmd.evalLine(ctx, "l-history --run 5"); err == nil {
+		t.Error("l-history --run 5: no error")
+	}
+
+	h, err = cmd.openHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := h.Entries(); len(entries) != 2 || entries[1].Line != "l-echo b" {
+		t.Errorf("entries after delete = %v", entries)
+	}
+
+	// An entry which runs the history does not run itself again.
+	if _, err := cmd.addHistory("l-history --run -1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.evalLine(ctx, "l-history --run -1"); err == nil || !strings.Contains(err.Error(), "cannot run a history entry") {
+		t.Errorf("l-history --run -1: err = %v", err)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	cmd, _ := newTestCmd()
+	ctx := context.Background()
+
+	if err := cmd.evalLine(ctx, "l-fn f {l-echo f}"); err != nil {
+		t.Fatal(err)
+	}
+
+	color := func(spec, text string) string {
+		code, err := ansiCode(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code + text + "\x1b[0m"
+	}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"l-echo a", color("cyan", "l-echo") + " a"},
+		{"f; sh", color("cyan", "f") + "; " + color("green", "sh")},
+		{"no-such-command a", color("red", "no-such-command") + " a"},
+		{`l-echo "a b" # c`, color("cyan", "l-echo") + " " + color("yellow", `"a b"`) + " " + color("dim", "# c")},
+		{"l-eval {true} {l-echo (l-cat)}",
+			color("cyan", "l-eval") + " " +
+				color("magenta", "{") + color("green", "true") + color("magenta", "}") + " " +
+				color("magenta", "{") + color("cyan", "l-echo") + " " +
+				color("blue", "(") + color("cyan", "l-cat") + color("blue", ")") + color("magenta", "}")},
+		{"l-echo a.{txt,md}", color("cyan", "l-echo") + " a.{txt,md}"},
+		{"l-echo {a", color("cyan", "l-echo") + " " + color("red,underline", "{") + color("red", "a")},
+		{"l-echo a)", color("cyan", "l-echo") + " a" + color("red,underline", ")")},
+		{`l-echo "a`, color("cyan", "l-echo") + " " + color("red,underline", `"a`)},
+		{"$cmd a", color("red", "$cmd") + " a"},
+	}
+	for _, tt := range tests {
+		if got := cmd.highlight(tt.line); got != tt.want {
+			t.Errorf("highlight(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h1, err := history.Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := history.Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		h    *history.History
+		line string
+	}{{h1, "a"}, {h2, "b"}, {h1, "c"}, {h2, "b"}} {
+		if _, err := v.h.Add(history.Entry{Line: v.line}, history.Options{EraseDups: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Erasing "b" in the second shell and deleting "a" in the first one
+	// keep the lines of the other shell.
+	if err := h1.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := history.Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{}
+	for _, e := range h.Entries() {
+		lines = append(lines, e.Line)
+	}
+	if got, want := strings.Join(lines, " "), "c b"; got != want {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	cmd, _ := newTestCmd()
+	ctx := context.Background()
+
+	h, err := history.Open("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.hist = h
+
+	dir := cmd.wd.get()
+	for _, e := range []history.Entry{
+		{Line: "l-echo hello", Cwd: dir},
+		{Line: "l-echo help", Cwd: "/"},
+		{Line: "git status", Cwd: dir},
+		{Line: "git", Cwd: dir},
+		{Line: "l-cat a", Cwd: dir},
+	} {
+		if _, err := h.Add(e, history.Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		mode string
+		line string
+		want string
+	}{
+		{"history", "l-echo h", "l-echo help"},
+		{"history", "git", "git status"},
+		{"history", "l-", "l-cat a"},
+		{"history", "l-cat a", ""},
+		{"history", "l-cp", ""},
+		{"history", "", ""},
+		{"cwd", "l-echo h", "l-echo hello"},
+		{"off", "l-echo h", ""},
+	}
+	for _, tt := range tests {
+		if err := cmd.evalLine(ctx, "l-var --del AUTOSUGGEST; l-var AUTOSUGGEST "+tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		if got := cmd.suggest(tt.line); got != tt.want {
+			t.Errorf("%v: suggest(%q) = %q, want %q", tt.mode, tt.line, got, tt.want)
+		}
+	}
+
+	if err := cmd.evalLine(ctx, "l-var --del AUTOSUGGEST; l-history --delete 2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := cmd.suggest("l-echo h"); got != "l-echo hello" {
+		t.Errorf("suggest after delete = %q", got)
+	}
+}
+
+func TestBind(t *testing.T) {
+	cmd, out := newTestCmd()
+	ctx := context.Background()
+
+	if err := cmd.evalLine(ctx, "l-bind ctrl-g beginning-of-line"); err == nil {
+		t.Error("l-bind without a line editor succeeded")
+	}
+
+	cmd.line = editor.New(os.Stdin, os.Stdout)
+
+	if err := cmd.evalLine(ctx, "l-bind --mode vi; l-echo (pr-mode)"); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "vi-insert\n" {
+		t.Errorf("pr-mode = %q", got)
+	}
+	out.Reset()
+
+	lines := []string{
+		"l-bind ctrl-g beginning-of-line",
+		`l-bind -k vi-command "g g" {l-echo (l-arg 0)}`,
+		`l-bind -k vi-command --replace "g u" {l-echo upper}`,
+		"l-bind -k vi-command --del p",
+	}
+	for _, line := range lines {
+		if err := cmd.evalLine(ctx, line); err != nil {
+			t.Fatalf("%v: %v", line, err)
+		}
+	}
+
+	bindings, err := cmd.line.Bindings("vi-command")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bindings["p"]; ok {
+		t.Error("p is still bound")
+	}
+	if b := bindings["g u"]; b.Func == nil {
+		t.Error("g u is not bound to a block")
+	} else if line, pos := b.Func("l-echo a", 3); line != "upper" || pos != 5 {
+		t.Errorf("g u = %q, %v", line, pos)
+	}
+
+	if err := cmd.evalLine(ctx, "l-bind --list"); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "\nctrl-g : beginning-of-line\n") {
+		t.Errorf("l-bind --list = %q", got)
+	}
+
+	for _, line := range []string{
+		"l-bind no-such-key beginning-of-line",
+		"l-bind -k no-such-keymap ctrl-g beginning-of-line",
+		"l-bind --del ctrl-q",
+		"l-bind --mode ed",
+	} {
+		if err := cmd.evalLine(ctx, line); err == nil {
+			t.Errorf("%v: succeeded", line)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	cmd, out := newTestCmd()
+	ctx := context.Background()
+
+	cmd.Internal.Cmds.Range(func(key, value interface{}) bool {
+		name, c := key.(string), value.(InternalCmd)
+		if !strings.HasPrefix(c.Synopsis, name) {
+			t.Errorf("%v: synopsis = %q", name, c.Synopsis)
+		}
+		if c.Desc == "" {
+			t.Errorf("%v: no description", name)
+		}
+		if err := c.flagSet(name).Parse([]string{}); err != nil {
+			t.Errorf("%v: %v", name, err)
+		}
+		for _, v := range c.Examples {
+			if _, err := parser.Parse(v); err != nil {
+				t.Errorf("%v: %q: %v", name, v, err)
+			}
+		}
+		return true
+	})
+
+	if err := cmd.evalLine(ctx, "l-help l-echo"); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"Usage: l-echo", "\nFlags:\n", "--fd n", "(default 1)", "\nExamples:\n"} {
+		if !strings.Contains(out.String(), v) {
+			t.Errorf("l-help l-echo does not contain %q:\n%v", v, out.String())
+		}
+	}
+	out.Reset()
+
+	if err := cmd.evalLine(ctx, "l-help --family s"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if !strings.HasPrefix(line, "s-") {
+			t.Errorf("l-help --family s: %q", line)
+		}
+	}
+	out.Reset()
+
+	if err := cmd.evalLine(ctx, "l-help --search regular"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "r-match ") || strings.Contains(out.String(), "s-split ") {
+		t.Errorf("l-help --search regular:\n%v", out.String())
+	}
+	out.Reset()
+
+	if err := cmd.evalLine(ctx, "l-echo -h"); err == nil {
+		t.Error("l-echo -h succeeded")
+	}
+	if !strings.HasPrefix(out.String(), "Usage: l-echo") {
+		t.Errorf("l-echo -h:\n%v", out.String())
+	}
+
+	for _, line := range []string{"l-help --family nosuch", "l-help --search nosuchtext", "l-help nosuch"} {
+		if err := cmd.evalLine(ctx, line); err == nil {
+			t.Errorf("%v succeeded", line)
+		}
+	}
+}
+
+func TestType(t *testing.T) {
+	cmd, out := newTestCmd()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	script := "# greet\nl-fn greet {\n  l-echo hello (l-arg 0)\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "lib.lsh"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := []string{
+		"l-source " + filepath.Join(dir, "lib.lsh"),
+		"l-alias ll {f-ls -l}",
+		"l-alias lll {ll -a}",
+	}
+	for _, line := range lines {
+		if err := cmd.evalLine(ctx, line); err != nil {
+			t.Fatalf("%v: %v", line, err)
+		}
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"l-type l-echo", "l-echo is a builtin of the l family\n"},
+		{"l-type lll", "lll is an alias for {ll -a}\nll is an alias for {f-ls -l}\nf-ls is a builtin of the f family\n"},
+		{"l-type -t lll greet l-echo", "alias\nfunction\nbuiltin\n"},
+		{"l-which l-echo", "l-echo is a builtin of the l family\n"},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		if err := cmd.evalLine(ctx, tt.expr); err != nil {
+			t.Fatalf("%v: %v", tt.expr, err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%v = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+
+	out.Reset()
+	if err := cmd.evalLine(ctx, "l-type greet"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "lib.lsh:2\nl-fn greet {"; !strings.Contains(out.String(), want) {
+		t.Errorf("l-type greet = %q, want %q in it", out.String(), want)
+	}
+
+	for _, line := range []string{"l-type nosuch-cmd-x", "l-which nosuch-cmd-x"} {
+		if err := cmd.evalLine(ctx, line); err == nil {
+			t.Errorf("%v succeeded", line)
+		}
+	}
+
+	if err := cmd.evalLine(ctx, "l-alias a {b -x}; l-alias b {a -y}"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"a", "l-type a", "l-eval {a}"} {
+		if err := cmd.evalLine(ctx, line); err == nil || !strings.Contains(err.Error(), "alias cycle: a -> b -> a") {
+			t.Errorf("%v: err = %v", line, err)
+		}
+	}
+}
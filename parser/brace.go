@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const maxBraceItems = 1 << 16
+
+// maskBraceGroups replaces the braces of "@{...}" groups in s with '@', so
+// that they are not taken for raw string delimiters.
+func maskBraceGroups(s string) string {
+	b := []byte(s)
+	opens := []int{}
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '@' && i+1 < len(b) && b[i+1] == '{':
+			opens = append(opens, i+1)
+			i++
+		case b[i] == '}' && len(opens) > 0:
+			b[opens[len(opens)-1]] = '@'
+			b[i] = '@'
+			opens = opens[:len(opens)-1]
+		}
+	}
+	return string(b)
+}
+
+func expandBraceTokens(tok []Token) ([]Token, error) {
+	res := []Token{}
+	for _, v := range tok {
+		if v.Kind != CommandToken || !strings.Contains(v.Val, "@{") {
+			res = append(res, v)
+			continue
+		}
+
+		words, err := ExpandBraces(v.Val)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, w := range words {
+			res = append(res, Token{
+				Kind: CommandToken,
+				Val:  w,
+			})
+		}
+	}
+	return res, nil
+}
+
+// ExpandBraces expands "@{a,b,c}" alternatives and "@{1..10}" sequences in
+// word. Sequences may have a step ("@{1..10..2}") and are zero padded when
+// either end is ("@{01..10}"). Groups can be nested.
+func ExpandBraces(word string) ([]string, error) {
+	start := strings.Index(word, "@{")
+	if start < 0 {
+		return []string{word}, nil
+	}
+
+	depth := 0
+	end := -1
+	commas := []int{}
+loop:
+	for i := start + 2; i < len(word); i++ {
+		switch {
+		case strings.HasPrefix(word[i:], "@{"):
+			depth++
+			i++
+		case word[i] == '}':
+			if depth == 0 {
+				end = i
+				break loop
+			}
+			depth--
+		case word[i] == ',' && depth == 0:
+			commas = append(commas, i)
+		}
+	}
+
+	if end < 0 {
+		return nil, fmt.Errorf("brace expansion not terminated: %v", word)
+	}
+
+	pre, body, post := word[:start], word[start+2:end], word[end+1:]
+
+	var items []string
+	if len(commas) == 0 {
+		seq, ok, err := braceSequence(body)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			items = seq
+		} else {
+			items = []string{body}
+		}
+	} else {
+		prev := start + 2
+		for _, c := range commas {
+			items = append(items, word[prev:c])
+			prev = c + 1
+		}
+		items = append(items, word[prev:end])
+	}
+
+	posts, err := ExpandBraces(post)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []string{}
+	for _, item := range items {
+		expanded, err := ExpandBraces(item)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range expanded {
+			for _, p := range posts {
+				res = append(res, pre+v+p)
+			}
+		}
+
+		if len(res) > maxBraceItems {
+			return nil, fmt.Errorf("brace expansion too large: %v", word)
+		}
+	}
+
+	return res, nil
+}
+
+func zeroPadded(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && strings.HasPrefix(s, "0")
+}
+
+// braceSequence expands "first..last[..step]". It reports false if body is
+// not a sequence.
+func braceSequence(body string) ([]string, bool, error) {
+	parts := strings.Split(body, "..")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, false, nil
+	}
+
+	step := 1
+	if len(parts) == 3 {
+		n, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, false, nil
+		}
+		if n == 0 {
+			return nil, false, fmt.Errorf("brace expansion step is zero: %v", body)
+		}
+		if n < 0 {
+			n = -n
+		}
+		step = n
+	}
+
+	first, err1 := strconv.Atoi(parts[0])
+	last, err2 := strconv.Atoi(parts[1])
+	isChar := false
+	switch {
+	case err1 == nil && err2 == nil:
+	case len(parts[0]) == 1 && len(parts[1]) == 1:
+		first, last = int(parts[0][0]), int(parts[1][0])
+		isChar = true
+	default:
+		return nil, false, nil
+	}
+
+	// The span overflows to a negative number for huge bounds.
+	span := last - first
+	if first > last {
+		span = first - last
+	}
+	if span < 0 || span/step >= maxBraceItems {
+		return nil, false, fmt.Errorf("brace expansion too large: %v", body)
+	}
+
+	width := 0
+	if zeroPadded(parts[0]) || zeroPadded(parts[1]) {
+		width = len(parts[0])
+		if len(parts[1]) > width {
+			width = len(parts[1])
+		}
+	}
+
+	if first > last {
+		step = -step
+	}
+
+	res := []string{}
+	for i := first; (step > 0 && i <= last) || (step < 0 && i >= last); i += step {
+		switch {
+		case isChar:
+			res = append(res, string(rune(i)))
+		default:
+			res = append(res, fmt.Sprintf("%0*d", width, i))
+		}
+	}
+
+	return res, true, nil
+}
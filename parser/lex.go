@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	CommandSpan      = "command"      // the name of a command
+	WordSpan         = "word"         // an argument
+	StringSpan       = "string"       // a quoted string
+	BlockSpan        = "block"        // "{" or "}"
+	SubstitutionSpan = "substitution" // "(" or ")"
+	SeparateSpan     = "separate"     // ";" or "&"
+	CommentSpan      = "comment"
+	ErrorSpan        = "error" // an unbalanced bracket or an unterminated string
+)
+
+// Span is a part of an expression, from Start to End in runes.
+type Span struct {
+	Kind       string
+	Start, End int
+}
+
+// closers are the characters which end a word when they are at its end.
+const closers = ")};&"
+
+// Lex splits expr into spans for syntax highlighting. Unlike Parse, it
+// keeps the positions of the parts and never fails: the parts which cannot
+// be parsed are ErrorSpan.
+func Lex(expr string) []Span {
+	r := []rune(expr)
+	spans := []Span{}
+	opened := []int{} // the spans of the brackets not closed yet
+
+	command := true
+	for i := 0; i < len(r); {
+		switch c := r[i]; {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '#':
+			spans = append(spans, Span{Kind: CommentSpan, Start: i, End: len(r)})
+			i = len(r)
+
+		case c == '"':
+			j := i + 1
+			for j < len(r) && r[j] != '"' {
+				if r[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(r) {
+				spans = append(spans, Span{Kind: ErrorSpan, Start: i, End: len(r)})
+				i = len(r)
+				break
+			}
+			spans = append(spans, Span{Kind: StringSpan, Start: i, End: j + 1})
+			command = false
+			i = j + 1
+
+		case c == '{' || c == '(':
+			kind := BlockSpan
+			if c == '(' {
+				kind = SubstitutionSpan
+			}
+			opened = append(opened, len(spans))
+			spans = append(spans, Span{Kind: kind, Start: i, End: i + 1})
+			command = true
+			i++
+
+		case c == '}' || c == ')':
+			open := '{'
+			kind := BlockSpan
+			if c == ')' {
+				open, kind = '(', SubstitutionSpan
+			}
+			if n := len(opened); n > 0 && r[spans[opened[n-1]].Start] == open {
+				opened = opened[:n-1]
+			} else {
+				kind = ErrorSpan
+			}
+			spans = append(spans, Span{Kind: kind, Start: i, End: i + 1})
+			command = false
+			i++
+
+		case c == ';' || c == '&':
+			spans = append(spans, Span{Kind: SeparateSpan, Start: i, End: i + 1})
+			command = true
+			i++
+
+		default:
+			j := i
+			for j < len(r) && !unicode.IsSpace(r[j]) && r[j] != '"' {
+				j++
+			}
+
+			// Brackets at the end of a word close a block or a
+			// substitution, unless they are opened in the word as in
+			// "a.{txt,md}".
+			k := j
+			for k > i && strings.ContainsRune(closers, r[k-1]) {
+				word := string(r[i : k-1])
+				if r[k-1] == '}' && strings.Count(word, "{") > strings.Count(word, "}") ||
+					r[k-1] == ')' && strings.Count(word, "(") > strings.Count(word, ")") {
+					break
+				}
+				k--
+			}
+
+			kind := WordSpan
+			if command {
+				kind = CommandSpan
+			}
+			spans = append(spans, Span{Kind: kind, Start: i, End: k})
+			command = false
+			i = k
+		}
+	}
+
+	for _, v := range opened {
+		spans[v].Kind = ErrorSpan
+	}
+
+	return spans
+}
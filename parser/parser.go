@@ -15,6 +15,7 @@ const (
 	RawStringToken    = "raw-string"
 	SubstitutionToken = "substitution"
 	SeparateToken     = "separate"
+	BackgroundToken   = "background"
 )
 
 var DEBUG = false
@@ -30,6 +31,7 @@ func Parse(expr string) ([]Token, error) {
 	var s scanner.Scanner
 	s.Init(strings.NewReader(expr))
 	s.Whitespace ^= 1 << ' '
+	s.Mode ^= scanner.ScanComments | scanner.SkipComments
 	s.Error = func(s *scanner.Scanner, msg string) {
 		errs = append(errs, fmt.Sprintf("%s %s", s.Pos(), msg))
 	}
@@ -94,9 +96,16 @@ func Parse(expr string) ([]Token, error) {
 		return nil, errors.New(strings.Join(errs, "\n"))
 	}
 
+	// A comment begins with a word starting with "#" outside of blocks. In a
+	// block, it is a comment of the block when the block is evaluated.
+	depth := 0
 	for i, v := range ret {
-		if strings.HasPrefix(v.Val, "#") {
+		if depth == 0 && strings.HasPrefix(v.Val, "#") {
 			ret = ret[:i]
+			break
+		}
+		if !strings.HasPrefix(v.Val, "\"") {
+			depth += strings.Count(v.Val, "{") - strings.Count(v.Val, "}")
 		}
 	}
 
@@ -111,6 +120,21 @@ func Parse(expr string) ([]Token, error) {
 		}
 	}
 
+	// A block closing a substitution, as in "(l-go {...})", is split from
+	// the closing parentheses so that both are found.
+	for i := 0; i < len(ret); i++ {
+		v := strings.TrimSuffix(ret[i].Val, ";")
+		j := len(strings.TrimRight(v, ")"))
+		if j == len(v) || j == 0 || v[j-1] != '}' {
+			continue
+		}
+
+		ret = append(ret, Token{})
+		copy(ret[i+2:], ret[i+1:])
+		ret[i+1] = Token{Kind: CommandToken, Val: ret[i].Val[j:]}
+		ret[i].Val = ret[i].Val[:j]
+	}
+
 	ret, err := ParenParser(ret, "{", "}", RawStringToken)
 	if err != nil {
 		return nil, err
@@ -149,6 +173,34 @@ func Parse(expr string) ([]Token, error) {
 		return nil, err
 	}
 
+	ret, err = expandBraceTokens(ret)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(ret); i++ {
+		if ret[i].Kind != CommandToken || !strings.HasSuffix(ret[i].Val, "&") {
+			continue
+		}
+
+		// Only a single "&" starts a job; there is no "&&".
+		if strings.HasSuffix(ret[i].Val, "&&") {
+			return nil, fmt.Errorf("unexpected &&: %v", ret[i].Val)
+		}
+
+		ret[i].Val = strings.TrimSuffix(ret[i].Val, "&")
+
+		if ret[i].Val == "" {
+			ret[i] = Token{Kind: BackgroundToken}
+			continue
+		}
+
+		ret = append(ret, Token{})
+		copy(ret[i+2:], ret[i+1:])
+		ret[i+1] = Token{Kind: BackgroundToken}
+		i++
+	}
+
 	if DEBUG {
 		pp.Println(ret)
 	}
@@ -161,11 +213,26 @@ func ParenParser(tok []Token, start, end, kind string) ([]Token, error) {
 	count := 0
 	tmp := ""
 	for i := 0; i < len(tok); i++ {
+		if count > 0 {
+			// Quoted words inside a substitution are kept as they are
+			// written, to be parsed again when it is evaluated.
+			switch tok[i].Kind {
+			case RawStringToken:
+				tmp = concat(tmp, "{"+tok[i].Val+"}")
+				continue
+			case StringToken:
+				tmp = concat(tmp, "\""+tok[i].Val+"\"")
+				continue
+			}
+		}
+
 		if tok[i].Kind == RawStringToken {
 			res = append(res, tok[i])
 			continue
 		}
 
+		val := maskBraceGroups(tok[i].Val)
+
 		b1 := func(s string) bool {
 			r1 := false
 			r2 := false
@@ -179,7 +246,7 @@ func ParenParser(tok []Token, start, end, kind string) ([]Token, error) {
 				s = strings.TrimPrefix(s, start)
 			}
 			return r2
-		}(tok[i].Val)
+		}(val)
 
 		b2 := func(s string) bool {
 			r1 := false
@@ -194,7 +261,7 @@ func ParenParser(tok []Token, start, end, kind string) ([]Token, error) {
 				s = strings.TrimSuffix(s, end)
 			}
 			return r2
-		}(tok[i].Val)
+		}(val)
 
 		if b1 || b2 || count > 0 {
 			tmp = concat(tmp, tok[i].Val)
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSubstitution(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []Token
+	}{
+		{
+			expr: `l-echo (l-echo "a b")`,
+			want: []Token{
+				{Kind: CommandToken, Val: "l-echo"},
+				{Kind: SubstitutionToken, Val: `l-echo "a b"`},
+			},
+		},
+		{
+			expr: `l-echo (l-echo {a b})`,
+			want: []Token{
+				{Kind: CommandToken, Val: "l-echo"},
+				{Kind: SubstitutionToken, Val: "l-echo {a b}"},
+			},
+		},
+		{
+			expr: `l-await (l-go {l-echo x})`,
+			want: []Token{
+				{Kind: CommandToken, Val: "l-await"},
+				{Kind: SubstitutionToken, Val: "l-go {l-echo x}"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseBackground(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []Token
+		err  bool
+	}{
+		{
+			expr: "l-echo a&",
+			want: []Token{
+				{Kind: CommandToken, Val: "l-echo"},
+				{Kind: CommandToken, Val: "a"},
+				{Kind: BackgroundToken},
+			},
+		},
+		{
+			expr: "l-echo a &",
+			want: []Token{
+				{Kind: CommandToken, Val: "l-echo"},
+				{Kind: CommandToken, Val: "a"},
+				{Kind: BackgroundToken},
+			},
+		},
+		{
+			expr: "l-echo a && l-echo b",
+			err:  true,
+		},
+		{
+			expr: "l-echo a&& l-echo b",
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.expr)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Parse(%q) = %#v, want an error", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package lalash
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Options configure the startup of the REPL.
+type Options struct {
+	NoRC   bool   // do not read the rc files
+	RCFile string // read this file instead of the rc files
+	Login  bool   // read the profile before the rc files
+}
+
+// blockEnd returns the index just past the block which begins at line[i], or
+// -1 if the block goes on to the next lines. Strings in the block are skipped
+// so that the braces in them are not counted.
+func blockEnd(line string, i int) int {
+	depth := 0
+	inString, escaped := false, false
+	for ; i < len(line); i++ {
+		switch c := line[i]; {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// blockDepth returns the number of blocks and substitutions opened by line,
+// less the ones it closes. Strings, which cannot span lines, and the blocks
+// which end on the line are skipped.
+func blockDepth(line string) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{':
+			if j := blockEnd(line, i); j >= 0 {
+				i = j - 1
+				break
+			}
+			depth++
+		case c == '(':
+			depth++
+		case c == '}' || c == ')':
+			depth--
+		}
+	}
+	return depth
+}
+
+// stripComment removes the comment at the end of a line, which begins with
+// an unquoted "#" at the start of a word. A "#" in a block which ends on the
+// line is left to the block.
+func stripComment(line string) string {
+	inString, escaped := false, false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{':
+			if j := blockEnd(line, i); j >= 0 {
+				i = j - 1
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// joinLine appends a line of a block which spans several lines. The lines are
+// joined as separate commands, unless they clearly continue one another.
+func joinLine(expr, line string) string {
+	expr = strings.TrimRight(expr, " \t")
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "":
+		return expr
+	case strings.HasSuffix(expr, "{"), strings.HasSuffix(expr, "("), strings.HasSuffix(expr, ";"),
+		strings.HasPrefix(line, "}"), strings.HasPrefix(line, ")"):
+		return expr + " " + line
+	}
+
+	return expr + "; " + line
+}
+
+// scanScript calls f with each command line of a script, where a block may
+// span several lines, and the number of the line where it begins.
+func scanScript(r io.Reader, f func(expr string, line int) error) error {
+	s := bufio.NewScanner(r)
+
+	expr := ""
+	depth := 0
+	start := 0
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		line = stripComment(line)
+
+		if expr == "" {
+			expr = line
+			start = n
+		} else {
+			expr = joinLine(expr, line)
+		}
+
+		depth += blockDepth(line)
+		if depth > 0 {
+			continue
+		}
+
+		e := expr
+		expr = ""
+		depth = 0
+		if err := f(e, start); err != nil {
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	if depth > 0 {
+		return fmt.Errorf("unexpected end of script: %v", expr)
+	}
+
+	return nil
+}
+
+type sourcePosKey struct{}
+
+// sourcePos is the position in a script of the command line being evaluated.
+type sourcePos struct {
+	file string
+	line int
+}
+
+func (pos sourcePos) String() string {
+	return fmt.Sprintf("%v:%d", pos.file, pos.line)
+}
+
+func withSourcePos(ctx context.Context, file string, line int) context.Context {
+	return context.WithValue(ctx, sourcePosKey{}, sourcePos{file: file, line: line})
+}
+
+// sourcePosOf returns the position of the command line being evaluated by
+// ctx, and false if it is not read from a file.
+func sourcePosOf(ctx context.Context) (sourcePos, bool) {
+	pos, ok := ctx.Value(sourcePosKey{}).(sourcePos)
+	return pos, ok
+}
+
+// sourceFile evaluates the file name in the scope of cmd.
+func sourceFile(ctx context.Context, cmd Command, name string) error {
+	p, err := cmd.absPath(name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return scanScript(f, func(expr string, line int) error {
+		return EvalString(withSourcePos(ctx, p, line), cmd, expr)
+	})
+}
+
+// configFiles returns the paths of a configuration file of lalash, in the XDG
+// config directory and in the home directory.
+func configFiles(xdgName, homeName string) []string {
+	files := []string{}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if dir != "" {
+		files = append(files, filepath.Join(dir, "lalash", xdgName))
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, homeName))
+	}
+
+	return files
+}
+
+// startupFiles returns the files which the REPL reads on startup.
+func (opts Options) startupFiles() []string {
+	files := []string{}
+
+	if opts.Login {
+		files = append(files, configFiles("profile", ".lalash_profile")...)
+	}
+
+	switch {
+	case opts.RCFile != "":
+		files = append(files, opts.RCFile)
+	case !opts.NoRC:
+		files = append(files, configFiles("rc", ".lalashrc")...)
+	}
+
+	return files
+}
+
+// loadStartupFiles sources the startup files which exist. An error in a file
+// is reported and does not stop the others.
+func loadStartupFiles(ctx context.Context, cmd Command, opts Options) {
+	for _, name := range opts.startupFiles() {
+		if _, err := os.Stat(name); err != nil {
+			if name == opts.RCFile {
+				fmt.Fprintln(cmd.Stderr, err.Error())
+			}
+			continue
+		}
+
+		if err := sourceFile(ctx, cmd, name); err != nil {
+			fmt.Fprintf(cmd.Stderr, "%v: %v\n", name, err)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package lalash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pseudo-signals of l-trap.
+const (
+	trapExit = "EXIT" // the shell exits
+	trapErr  = "ERR"  // a command line of the shell fails
+)
+
+func signalName(sig os.Signal) string {
+	for name, s := range trapSignals {
+		if s == sig {
+			return name
+		}
+	}
+	return sig.String()
+}
+
+// parseSignal returns the name of a signal given as "INT", "SIGINT" or "int".
+func parseSignal(name string) (string, error) {
+	n := strings.TrimPrefix(strings.ToUpper(name), "SIG")
+	if _, ok := trapSignals[n]; ok || n == trapExit || n == trapErr {
+		return n, nil
+	}
+	return "", fmt.Errorf("invalid signal: %v", name)
+}
+
+// signals dispatches the signals received by the shell. A trapped signal runs
+// its handler before the next command, and the signals caught by default
+// cancel the current command line unless they are trapped.
+type signals struct {
+	shell   Command
+	deflt   chan os.Signal
+	trap    map[os.Signal]chan os.Signal
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	pending []string
+	running bool
+}
+
+func newSignals(shell Command, deflt ...os.Signal) *signals {
+	s := &signals{
+		deflt: make(chan os.Signal, 1),
+		trap:  map[os.Signal]chan os.Signal{},
+	}
+	s.shell = shell
+	s.shell.signals = s
+
+	signal.Notify(s.deflt, deflt...)
+	go func() {
+		for sig := range s.deflt {
+			if s.trapped(sig) {
+				continue
+			}
+			s.mu.Lock()
+			if s.cancel != nil {
+				s.cancel()
+			}
+			s.mu.Unlock()
+		}
+	}()
+
+	return s
+}
+
+// stop restores the handling of every signal caught by s.
+func (s *signals) stop() {
+	signal.Stop(s.deflt)
+	close(s.deflt)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sig, c := range s.trap {
+		signal.Stop(c)
+		close(c)
+		delete(s.trap, sig)
+	}
+}
+
+func (s *signals) trapped(sig os.Signal) bool {
+	_, ok := s.shell.Internal.Traps.Load(signalName(sig))
+	return ok
+}
+
+// watch catches the signals which have traps, and stops catching the others.
+func (s *signals) watch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, sig := range trapSignals {
+		c, watching := s.trap[sig]
+		_, trapped := s.shell.Internal.Traps.Load(name)
+
+		switch {
+		case trapped && !watching:
+			c = make(chan os.Signal, 1)
+			s.trap[sig] = c
+			signal.Notify(c, sig)
+			go func() {
+				for sig := range c {
+					if !s.trapped(sig) {
+						continue
+					}
+					s.mu.Lock()
+					s.pending = append(s.pending, signalName(sig))
+					s.mu.Unlock()
+				}
+			}()
+
+		case !trapped && watching:
+			signal.Stop(c)
+			close(c)
+			delete(s.trap, sig)
+		}
+	}
+}
+
+// context returns the context of a command line, which is cancelled by the
+// signals caught by default.
+func (s *signals) context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	return ctx, cancel
+}
+
+// runTraps runs the handlers of the signals received since the last call.
+// Signals received while a handler runs wait for the next call.
+func (s *signals) runTraps(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running || len(s.pending) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	pending := s.pending
+	s.pending = nil
+	s.running = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	for _, name := range pending {
+		if err := s.shell.runTrap(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cmd Command) runTrap(ctx context.Context, name string) error {
+	v, ok := cmd.Internal.Traps.Load(name)
+	if !ok || v.(string) == "" {
+		return nil
+	}
+	return EvalString(ctx, cmd, v.(string))
+}
+
+// evalLine evaluates a command line of the shell, and runs the ERR trap if it
+// fails.
+func (cmd Command) evalLine(ctx context.Context, expr string) error {
+	start := time.Now()
+
+	err := EvalString(ctx, cmd, expr)
+	if err == nil && cmd.signals != nil {
+		err = cmd.signals.runTraps(ctx)
+	}
+
+	if err != shellExitErr && err != funcReturnErr {
+		cmd.last.set(err, time.Since(start))
+	}
+
+	if err != nil && err != shellExitErr && err != funcReturnErr {
+		if e := cmd.runTrap(context.Background(), trapErr); e != nil {
+			return e
+		}
+	}
+
+	return err
+}
+
+// exit runs the EXIT trap and returns the exit code of the shell.
+func (cmd Command) exit(code int) int {
+	if err := cmd.runTrap(context.Background(), trapExit); err != nil && err != shellExitErr {
+		fmt.Fprintln(cmd.Stderr, err.Error())
+		return exitCodeErr
+	}
+	return code
+}
+
+func (cmd Command) setInternalTrapFamily() {
+	cmd.Internal.Cmds.Store("l-trap", InternalCmd{
+		Synopsis: "l-trap {block} <signals...> | --reset [signals...] | --list",
+		Desc: "Sets the block called when the shell receives one of the signals, or when it exits with EXIT.\n" +
+			"The signals are written as INT or SIGINT, and ERR is called when a command line fails.",
+		Flags: []Flag{
+			{Name: "list", Value: false, Usage: "list the traps"},
+			{Name: "reset", Value: false, Usage: "remove the traps of the signals, or all of them"},
+		},
+		Examples: []string{
+			"l-trap {l-echo bye} EXIT",
+			"l-trap --reset INT",
+		},
+		Fn: func(ctx context.Context, cmd Command, args string, argv ...string) error {
+			f, err := cmd.parseFlags("l-trap", argv)
+			if err != nil {
+				return err
+			}
+			list := flagBool(f, "list")
+			reset := flagBool(f, "reset")
+
+			if list {
+				names := []string{}
+				cmd.Internal.Traps.Range(func(key, value interface{}) bool {
+					names = append(names, key.(string))
+					return true
+				})
+				sort.Strings(names)
+
+				for _, name := range names {
+					v, _ := cmd.Internal.Traps.Load(name)
+					fmt.Fprintln(cmd.Stdout, name, ":", v)
+				}
+
+				return nil
+			}
+
+			names := f.Args()
+			if !reset {
+				if err := checkArgv(names, 2); err != nil {
+					return err
+				}
+				names = names[1:]
+			}
+
+			for i, v := range names {
+				name, err := parseSignal(v)
+				if err != nil {
+					return err
+				}
+				names[i] = name
+			}
+
+			switch {
+			case reset && len(names) == 0:
+				cmd.Internal.Traps.Range(func(key, value interface{}) bool {
+					cmd.Internal.Traps.Delete(key)
+					return true
+				})
+			case reset:
+				for _, name := range names {
+					cmd.Internal.Traps.Delete(name)
+				}
+			default:
+				for _, name := range names {
+					cmd.Internal.Traps.Store(name, f.Arg(0))
+				}
+			}
+
+			if cmd.signals != nil {
+				cmd.signals.watch()
+			}
+
+			return nil
+		},
+	})
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package lalash
+
+import (
+	"os"
+	"syscall"
+)
+
+// trapSignals are the signals which l-trap can handle.
+var trapSignals = map[string]os.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"TERM":  syscall.SIGTERM,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"WINCH": syscall.SIGWINCH,
+}
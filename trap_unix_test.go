@@ -0,0 +1,76 @@
+//go:build !windows
+// +build !windows
+
+package lalash
+
+import (
+	"context"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterrupt(t *testing.T) {
+	cmd, out := newTestCmd()
+	cmd.signals = newSignals(cmd, os.Interrupt)
+	defer cmd.signals.stop()
+
+	ctx, cancel := cmd.signals.context(context.Background())
+	defer cancel()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+
+	start := time.Now()
+	if err := EvalString(ctx, cmd, "sleep 10; echo after"); err == nil {
+		t.Errorf("err = nil, want an error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("interrupted after %v", d)
+	}
+	if strings.Contains(out.String(), "after") {
+		t.Errorf("the command line continued after the interrupt: %q", out.String())
+	}
+}
+
+func TestTrap(t *testing.T) {
+	cmd, out := newTestCmd()
+	cmd.signals = newSignals(cmd, os.Interrupt)
+	defer cmd.signals.stop()
+
+	ctx, cancel := cmd.signals.context(context.Background())
+	defer cancel()
+
+	if err := cmd.evalLine(ctx, "l-trap {echo trapped} USR1; l-trap {echo interrupted} SIGINT"); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+		time.Sleep(100 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+
+	if err := cmd.evalLine(ctx, "sleep 0.5; echo next"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "trapped\ninterrupted\nnext\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	if err := cmd.evalLine(ctx, "l-trap {echo failed} ERR; l-trap {echo bye} EXIT; false"); err == nil {
+		t.Errorf("err = nil, want an error")
+	}
+	if code := cmd.exit(exitCodeOK); code != exitCodeOK {
+		t.Errorf("exit code = %d", code)
+	}
+	if got, want := out.String(), "failed\nbye\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,14 @@
+package lalash
+
+import (
+	"os"
+	"syscall"
+)
+
+// trapSignals are the signals which l-trap can handle.
+var trapSignals = map[string]os.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+}